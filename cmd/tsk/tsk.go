@@ -3,11 +3,18 @@ package main
 // Version and commit are set at build time via ldflags
 
 import (
+	"errors"
 	"fmt"
+	"maps"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/notnmeyer/tsk/internal/history"
 	output "github.com/notnmeyer/tsk/internal/outputformat"
 	"github.com/notnmeyer/tsk/internal/task"
 
@@ -20,16 +27,28 @@ var (
 )
 
 type Options struct {
-	cliArgs        string
-	displayVersion bool
-	filter         string
-	init           bool
-	listTasks      bool
-	output         string
-	pure           bool
-	taskFile       string
-	tasks          []string
-	which          bool
+	all             bool
+	cliArgs         []string
+	displayVersion  bool
+	explain         bool
+	filter          string
+	history         bool
+	init            bool
+	jobs            int
+	keepGoing       bool
+	last            bool
+	listTasks       bool
+	output          string
+	params          map[string]map[string]string
+	pure            bool
+	purePassthrough []string
+	recursive       bool
+	rerunFailed     bool
+	resume          bool
+	taskFiles       []string
+	tasks           []string
+	watch           bool
+	which           bool
 }
 
 const defaultOutputFormat = output.OutputFormat(output.Text)
@@ -41,16 +60,30 @@ func init() {
 
 func main() {
 	opts := Options{}
+	flag.BoolVar(&opts.all, "all", false, "run each task in every included taskfile that defines it")
 	flag.BoolVarP(&opts.displayVersion, "version", "V", false, "display tsk version")
+	flag.BoolVar(&opts.explain, "explain", false, "print each task's env and where every variable came from")
 	flag.StringVarP(&opts.filter, "filter", "F", ".*", "regex filter for --list")
+	flag.BoolVar(&opts.history, "history", false, "list recent runs")
 	flag.BoolVar(&opts.init, "init", false, "create a tasks.toml file in $PWD")
+	flag.IntVarP(&opts.jobs, "jobs", "j", 0, "how many tasks matched by a glob or --all run at once (default: the number of CPUs)")
+	flag.BoolVarP(&opts.keepGoing, "keep-going", "k", false, "keep running tasks that don't depend on a failed task")
+	flag.BoolVar(&opts.last, "last", false, "repeat the previous run")
 	flag.BoolVarP(&opts.listTasks, "list", "l", false, "list tasks")
 	flag.StringVarP(&opts.output, "output", "o", "text", fmt.Sprintf("output format (applies only to --list) (one of: %s)", output.String()))
 	flag.BoolVarP(&opts.pure, "pure", "", false, "don't inherit the parent env")
-	flag.StringVarP(&opts.taskFile, "file", "f", "", "taskfile to use")
-	flag.BoolVar(&opts.which, "which", false, "print the path to the found tasks.toml, or an error")
+	flag.StringSliceVar(&opts.purePassthrough, "pure-passthrough", nil, "globs of env vars pure tasks inherit, e.g. PATH,LANG*")
+	flag.BoolVarP(&opts.recursive, "recursive", "r", false, "run the tasks in every taskfile below the current directory that defines them")
+	flag.BoolVar(&opts.rerunFailed, "rerun-failed", false, "re-run only the tasks that failed in the previous run")
+	flag.BoolVar(&opts.resume, "resume", false, "resume the previous run from the task that failed")
+	flag.StringArrayVarP(&opts.taskFiles, "file", "f", nil, "taskfile to use, or - to read it from stdin. repeat to merge several in order")
+	flag.BoolVarP(&opts.watch, "watch", "w", false, "re-run tasks when their watched files change")
+	flag.BoolVar(&opts.which, "which", false, "print the path to the found tasks.toml and its tasks.local.toml, or an error")
 	flag.BoolVarP(&help, "help", "h", false, "")
-	flag.Parse()
+	// --name value flags that aren't tsk's own are task params, rewritten once
+	// the taskfile says which params they are
+	own, args := splitFlags(os.Args[1:], flag.CommandLine)
+	flag.CommandLine.Parse(own)
 
 	// flags that exit early and don't require parsing the taskfile
 	switch {
@@ -74,23 +107,95 @@ func main() {
 		os.Exit(1)
 	}
 
-	opts.tasks, opts.cliArgs = parseArgs(flag.Args(), flag.CommandLine.ArgsLenAtDash())
+	if opts.recursive {
+		if err := runRecursive(opts, args); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
 
 	// cfg is the parsed task file
-	cfg, err := task.NewTaskConfig(opts.taskFile, opts.cliArgs, opts.listTasks)
+	cfg, err := task.NewTaskConfig(opts.taskFiles...)
 	if err != nil {
 		panic(err)
 	}
 
+	opts.tasks, opts.params, opts.cliArgs, err = taskArgs(args, []*task.Config{cfg})
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
 	if opts.which {
 		fmt.Println(cfg.TaskFilePath)
+		for _, overlay := range cfg.Overlays {
+			fmt.Println(overlay)
+		}
+	}
+
+	if opts.history {
+		runs, err := history.Load(cfg.TaskFileDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		history.Print(os.Stdout, runs)
+		return
+	}
+
+	// repeat the previous run, or just the parts of it that failed
+	var resumed *history.Run
+	if opts.last || opts.rerunFailed || opts.resume {
+		last, err := history.Last(cfg.TaskFileDir)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+
+		opts.tasks, opts.cliArgs, opts.pure = last.Tasks, last.CliArgs, last.Pure
+		opts.keepGoing, opts.purePassthrough = last.KeepGoing, last.PurePassthrough
+		opts.params, opts.all = last.Params, last.All
+
+		// reload the taskfiles the run used when they weren't given again
+		if len(last.TaskFiles) > 0 && !slices.Equal(last.TaskFiles, absTaskFiles(opts.taskFiles)) {
+			if opts.resume && slices.Contains(last.TaskFiles, "-") {
+				fmt.Println("the previous run read a taskfile from stdin and can't be resumed")
+				os.Exit(1)
+			}
+			opts.taskFiles = last.TaskFiles
+			if cfg, err = task.NewTaskConfig(opts.taskFiles...); err != nil {
+				panic(err)
+			}
+		}
+		switch {
+		case opts.rerunFailed:
+			// the failed tasks are named in full, so they aren't matched again
+			opts.tasks, opts.all = last.FailedTasks(), false
+			if len(opts.tasks) == 0 {
+				fmt.Println("no tasks failed in the previous run")
+				return
+			}
+		case opts.resume:
+			if err := checkResumable(last, cfg); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			resumed = last
+		}
 	}
 
 	exec := task.Executor{
-		Stdout: os.Stdout,
-		Stdin:  os.Stdin,
-		Stderr: os.Stderr,
-		Config: cfg,
+		Stdout:    os.Stdout,
+		Stdin:     os.Stdin,
+		Stderr:    os.Stderr,
+		Config:    cfg,
+		KeepGoing: opts.keepGoing,
+		Params:    opts.params,
+		Prompt:    task.StdinIsTerminal(),
+		Args:      opts.cliArgs,
+		All:       opts.all,
+		Jobs:      opts.jobs,
 	}
 
 	if opts.listTasks {
@@ -98,12 +203,7 @@ func main() {
 		return
 	}
 
-	if opts.pure {
-		for name, task := range exec.Config.Tasks {
-			task.Pure = true
-			exec.Config.Tasks[name] = task
-		}
-	}
+	applyEnvFlags(exec.Config, opts)
 
 	// verify the tasks at the cli exist
 	if err := exec.VerifyTasks(opts.tasks); err != nil {
@@ -111,17 +211,349 @@ func main() {
 		os.Exit(1)
 	}
 
-	if err := exec.RunTasks(exec.Config, &opts.tasks); err != nil {
+	// validate params, prompting for missing ones, before anything runs
+	if err := exec.VerifyParams(opts.tasks); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if opts.explain {
+		var tasks []string
+		for _, name := range opts.tasks {
+			tasks = append(tasks, exec.MatchTasks(name)...)
+		}
+		for i, name := range tasks {
+			if len(tasks) > 1 {
+				if i > 0 {
+					fmt.Println("")
+				}
+				fmt.Printf("%s:\n", name)
+			}
+			if err := exec.ExplainEnv(exec.Config, name); err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+		}
+		return
+	}
+
+	if opts.watch {
+		if err := exec.Watch(exec.Config, &opts.tasks); err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if err := runAndRecord(&exec, opts, resumed); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 }
 
-func parseArgs(args []string, dashIndex int) (tasks []string, cliArgs string) {
+// applies --pure and --pure-passthrough to every task in cfg
+func applyEnvFlags(cfg *task.Config, opts Options) {
+	cfg.AddPurePassthrough(opts.purePassthrough)
+
+	if opts.pure {
+		pure := true
+		for name, task := range cfg.Tasks {
+			task.Pure = &pure
+			cfg.Tasks[name] = task
+		}
+	}
+}
+
+// runs the tasks in every taskfile below the current dir that defines them.
+// each taskfile keeps its own history, so recursive runs aren't recorded
+func runRecursive(opts Options, args []string) error {
+	dir, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	files, err := task.FindTaskFiles(dir)
+	if err != nil {
+		return err
+	}
+
+	var configs []*task.Config
+	for _, file := range files {
+		cfg, err := task.NewTaskConfig(file)
+		if err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+		applyEnvFlags(cfg, opts)
+		configs = append(configs, cfg)
+	}
+
+	opts.tasks, opts.params, opts.cliArgs, err = taskArgs(args, configs)
+	if err != nil {
+		return err
+	}
+
+	exec := task.Executor{
+		Stdout:    os.Stdout,
+		Stdin:     os.Stdin,
+		Stderr:    os.Stderr,
+		KeepGoing: opts.keepGoing,
+		Params:    opts.params,
+		Prompt:    task.StdinIsTerminal(),
+		Args:      opts.cliArgs,
+		Jobs:      opts.jobs,
+	}
+	return exec.RunRecursive(dir, configs, opts.tasks)
+}
+
+// verifies a run can be resumed and restores the env vars it recorded
+func checkResumable(run *history.Run, cfg *task.Config) error {
+	if run.ExitCode == 0 {
+		return fmt.Errorf("the previous run succeeded, there's nothing to resume")
+	}
+
+	hash, err := history.HashFiles(cfg.Files())
+	if err != nil {
+		return err
+	}
+	if hash != run.TaskFileHash {
+		return fmt.Errorf("%s or a file it loads has changed since the previous run, refusing to resume", cfg.TaskFilePath)
+	}
+
+	for _, kv := range run.Env {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			os.Setenv(k, v)
+		}
+	}
+	return nil
+}
+
+// runs the tasks and records the run in the history file. when resuming a run
+// the tasks that already succeeded are skipped, and carried over to the new
+// run so it can be resumed again
+func runAndRecord(exec *task.Executor, opts Options, resumed *history.Run) error {
+	run := history.Run{
+		Tasks:           opts.tasks,
+		Params:          exec.Params,
+		CliArgs:         opts.cliArgs,
+		Pure:            opts.pure,
+		PurePassthrough: opts.purePassthrough,
+		KeepGoing:       opts.keepGoing,
+		All:             opts.all,
+		TaskFiles:       absTaskFiles(opts.taskFiles),
+		Start:           time.Now(),
+	}
+
+	if env, err := exec.Config.ResumeEnv(); err == nil {
+		run.Env = env
+	}
+
+	if resumed != nil {
+		exec.Skip = make(map[string]bool)
+		for _, name := range resumed.SucceededTasks() {
+			exec.Skip[name] = true
+		}
+		for _, result := range resumed.Results {
+			if result.ExitCode == 0 {
+				run.Results = append(run.Results, result)
+			}
+		}
+	}
+
+	if hash, err := history.HashFiles(exec.Config.Files()); err == nil {
+		run.TaskFileHash = hash
+	}
+
+	var mu sync.Mutex
+	exec.OnResult = func(r task.Result) {
+		mu.Lock()
+		defer mu.Unlock()
+		run.Results = append(run.Results, history.Result{
+			Task:     r.Task,
+			Start:    r.Start,
+			End:      r.End,
+			ExitCode: task.ExitCode(r.Err),
+		})
+	}
+
+	err := exec.RunTasks(exec.Config, &opts.tasks)
+
+	run.End = time.Now()
+	run.ExitCode = task.ExitCode(err)
+	var taskErr *task.TaskError
+	if errors.As(err, &taskErr) {
+		run.Failed = taskErr.Task
+	}
+
+	if len(run.Tasks) > 0 {
+		if err := history.Append(exec.Config.TaskFileDir, run); err != nil {
+			fmt.Fprintf(os.Stderr, "couldn't record run history: %s\n", err)
+		}
+	}
+
+	return err
+}
+
+// splits args into tasks, the params that follow each task, and the CLI_ARGS
+// after --. a param is a name=value pair and applies to the task before it
+func parseArgs(args []string, dashIndex int) (tasks []string, params map[string]map[string]string, cliArgs []string, err error) {
 	if dashIndex >= 0 {
-		tasks = args[:dashIndex]
-		cliArgs = strings.Join(args[dashIndex:], " ")
-		return tasks, cliArgs
+		cliArgs = args[dashIndex:]
+		args = args[:dashIndex]
+	}
+
+	for _, arg := range args {
+		name, value, isParam := strings.Cut(arg, "=")
+		if !isParam {
+			tasks = append(tasks, arg)
+			continue
+		}
+		if len(tasks) == 0 {
+			return nil, nil, nil, fmt.Errorf("param '%s' must follow the task it's for", name)
+		}
+
+		if params == nil {
+			params = make(map[string]map[string]string)
+		}
+		task := tasks[len(tasks)-1]
+		if params[task] == nil {
+			params[task] = make(map[string]string)
+		}
+		params[task][name] = value
+	}
+	return tasks, params, cliArgs, nil
+}
+
+// taskFiles made absolute so a run can be repeated from any dir, except - for
+// stdin
+func absTaskFiles(taskFiles []string) []string {
+	var abs []string
+	for _, file := range taskFiles {
+		if path, err := filepath.Abs(file); err == nil && file != "-" {
+			file = path
+		}
+		abs = append(abs, file)
+	}
+	return abs
+}
+
+// splits args into tsk's own flags, along with their values, and everything
+// else: tasks, params, param flags and anything after --
+func splitFlags(args []string, flags *flag.FlagSet) (own, rest []string) {
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return own, append(rest, args[i:]...)
+		case strings.HasPrefix(arg, "--"):
+			name, _, hasValue := strings.Cut(arg[2:], "=")
+			f := flags.Lookup(name)
+			if f == nil {
+				rest = append(rest, arg)
+				continue
+			}
+			own = append(own, arg)
+			if !hasValue && f.NoOptDefVal == "" && i+1 < len(args) {
+				own = append(own, args[i+1])
+				i++
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			// shorthands can be combined, e.g. -kj4 or -kj 4, and only the last
+			// one can take its value from the next arg
+			own = append(own, arg)
+			for j := 1; j < len(arg); j++ {
+				f := flags.ShorthandLookup(arg[j : j+1])
+				if f == nil || f.NoOptDefVal != "" {
+					continue
+				}
+				if j == len(arg)-1 && i+1 < len(args) {
+					own = append(own, args[i+1])
+					i++
+				}
+				break
+			}
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	return own, rest
+}
+
+// the tasks, params and cli args given by args, the ones left after tsk's own
+// flags, with param flags checked against the tasks in configs
+func taskArgs(args []string, configs []*task.Config) (tasks []string, params map[string]map[string]string, cliArgs []string, err error) {
+	for _, cfg := range configs {
+		if err := checkParamNames(cfg, flag.CommandLine); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	isBool := func(task, name string) bool {
+		for _, cfg := range configs {
+			if cfg.Tasks[task].Params[name].Type == "bool" {
+				return true
+			}
+		}
+		return false
+	}
+	isTask := func(name string) bool {
+		for _, cfg := range configs {
+			if _, ok := cfg.Tasks[name]; ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	args = paramFlags(args, isBool, isTask)
+	dashIndex := slices.Index(args, "--")
+	if dashIndex >= 0 {
+		args = slices.Delete(args, dashIndex, dashIndex+1)
+	}
+	return parseArgs(args, dashIndex)
+}
+
+// verifies no task has a param named after one of tsk's own flags, which would
+// take --name before the task could
+func checkParamNames(cfg *task.Config, flags *flag.FlagSet) error {
+	for _, name := range slices.Sorted(maps.Keys(cfg.Tasks)) {
+		for _, param := range slices.Sorted(maps.Keys(cfg.Tasks[name].Params)) {
+			if flags.Lookup(param) != nil {
+				return fmt.Errorf("param '%s' of task '%s' clashes with tsk's --%s flag, rename it", param, name, param)
+			}
+		}
+	}
+	return nil
+}
+
+// rewrites --name value and --name=value flags as name=value params of the
+// task before them. a flag without a value, like --force, is name=true, as is
+// one that's followed by a task or is a bool param of its task
+func paramFlags(args []string, isBool func(task, name string) bool, isTask func(name string) bool) []string {
+	var rewritten []string
+	var task string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(rewritten, args[i:]...)
+		}
+
+		if !strings.HasPrefix(arg, "--") {
+			if !strings.Contains(arg, "=") {
+				task = arg
+			}
+			rewritten = append(rewritten, arg)
+			continue
+		}
+
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if !hasValue {
+			value = "true"
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") && !isBool(task, name) && !isTask(args[i+1]) {
+				value = args[i+1]
+				i++
+			}
+		}
+		rewritten = append(rewritten, name+"="+value)
 	}
-	return args, ""
+	return rewritten
 }
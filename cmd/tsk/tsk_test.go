@@ -1,7 +1,12 @@
 package main
 
 import (
+	"reflect"
 	"testing"
+
+	"github.com/notnmeyer/tsk/internal/task"
+
+	flag "github.com/spf13/pflag"
 )
 
 func TestParseArgs(t *testing.T) {
@@ -9,38 +14,116 @@ func TestParseArgs(t *testing.T) {
 		name            string
 		input           []string
 		expectedTasks   []string
-		expectedCliArgs string
+		expectedParams  map[string]map[string]string
+		expectedCliArgs []string
 		dashIndex       int
 	}{
 		{
 			name:            "tasks and args",
 			input:           []string{"task1", "task2", "arg1", "arg2"},
 			expectedTasks:   []string{"task1", "task2"},
-			expectedCliArgs: "arg1 arg2",
+			expectedCliArgs: []string{"arg1", "arg2"},
 			dashIndex:       2,
 		},
 		{
 			name:            "just tasks",
 			input:           []string{"task1", "task2"},
 			expectedTasks:   []string{"task1", "task2"},
-			expectedCliArgs: "",
+			expectedCliArgs: nil,
 			dashIndex:       -1,
 		},
+		{
+			name:            "args keep their boundaries",
+			input:           []string{"run", "hello world", "$HOME"},
+			expectedTasks:   []string{"run"},
+			expectedCliArgs: []string{"hello world", "$HOME"},
+			dashIndex:       1,
+		},
+		{
+			name:            "tasks with params",
+			input:           []string{"deploy", "env=prod", "replicas=3", "test", "env=ci", "a=b"},
+			expectedTasks:   []string{"deploy", "test"},
+			expectedParams:  map[string]map[string]string{"deploy": {"env": "prod", "replicas": "3"}, "test": {"env": "ci"}},
+			expectedCliArgs: []string{"a=b"},
+			dashIndex:       5,
+		},
 	}
 
 	for _, test := range tests {
 		t.Run(test.name, func(t *testing.T) {
-			tasks, cliArgs := parseArgs(test.input, test.dashIndex)
+			tasks, params, cliArgs, err := parseArgs(test.input, test.dashIndex)
+			if err != nil {
+				t.Fatalf("Expected no error, got: %v", err)
+			}
 			if !equalSlices(tasks, test.expectedTasks) {
 				t.Errorf("Expected tasks: %v, got: %v", test.expectedTasks, tasks)
 			}
-			if cliArgs != test.expectedCliArgs {
+			if !reflect.DeepEqual(params, test.expectedParams) {
+				t.Errorf("Expected params: %v, got: %v", test.expectedParams, params)
+			}
+			if !equalSlices(cliArgs, test.expectedCliArgs) {
 				t.Errorf("Expected cliArgs: %q, got: %q", test.expectedCliArgs, cliArgs)
 			}
 		})
 	}
 }
 
+func TestParseArgsParamBeforeTask(t *testing.T) {
+	if _, _, _, err := parseArgs([]string{"env=prod", "deploy"}, -1); err == nil {
+		t.Errorf("Expected an error for a param before any task")
+	}
+}
+
+func TestParamFlags(t *testing.T) {
+	isBool := func(task, name string) bool { return task == "deploy" && name == "force" }
+	isTask := func(name string) bool { return name == "deploy" || name == "lint" }
+
+	input := []string{"deploy", "--env", "prod", "--replicas=3", "--force", "lint", "--fix", "lint", "--dry-run", "--", "--env", "x"}
+	expected := []string{"deploy", "env=prod", "replicas=3", "force=true", "lint", "fix=true", "lint", "dry-run=true", "--", "--env", "x"}
+
+	if got := paramFlags(input, isBool, isTask); !equalSlices(got, expected) {
+		t.Errorf("Expected %v, got: %v", expected, got)
+	}
+}
+
+func TestSplitFlags(t *testing.T) {
+	flags := flag.NewFlagSet("tsk", flag.ContinueOnError)
+	flags.Bool("pure", false, "")
+	flags.BoolP("keep-going", "k", false, "")
+	flags.IntP("jobs", "j", 0, "")
+	flags.StringArrayP("file", "f", nil, "")
+
+	input := []string{"--pure", "deploy", "--env", "prod", "-f", "tasks.toml", "-kj", "4", "--file=x.toml", "-j2", "--force", "--", "--pure"}
+	expectedOwn := []string{"--pure", "-f", "tasks.toml", "-kj", "4", "--file=x.toml", "-j2"}
+	expectedRest := []string{"deploy", "--env", "prod", "--force", "--", "--pure"}
+
+	own, rest := splitFlags(input, flags)
+	if !equalSlices(own, expectedOwn) {
+		t.Errorf("Expected own flags %v, got: %v", expectedOwn, own)
+	}
+	if !equalSlices(rest, expectedRest) {
+		t.Errorf("Expected rest %v, got: %v", expectedRest, rest)
+	}
+}
+
+func TestCheckParamNames(t *testing.T) {
+	flags := flag.NewFlagSet("tsk", flag.ContinueOnError)
+	flags.BoolP("watch", "w", false, "")
+
+	cfg := &task.Config{Tasks: map[string]task.Task{
+		"deploy": {Params: map[string]task.Param{"env": {}}},
+	}}
+	if err := checkParamNames(cfg, flags); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	cfg.Tasks["serve"] = task.Task{Params: map[string]task.Param{"watch": {}}}
+	expected := "param 'watch' of task 'serve' clashes with tsk's --watch flag, rename it"
+	if err := checkParamNames(cfg, flags); err == nil || err.Error() != expected {
+		t.Errorf("Expected %q, got: %v", expected, err)
+	}
+}
+
 func equalSlices(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -3,13 +3,16 @@ module github.com/notnmeyer/tsk
 go 1.23.0
 
 require (
+	filippo.io/age v1.2.1
 	github.com/BurntSushi/toml v1.5.0
+	github.com/fsnotify/fsnotify v1.9.0
 	github.com/joho/godotenv v1.5.1
 	github.com/spf13/pflag v1.0.10
+	golang.org/x/term v0.32.0
 	mvdan.cc/sh/v3 v3.12.0
 )
 
 require (
+	golang.org/x/crypto v0.24.0 // indirect
 	golang.org/x/sys v0.33.0 // indirect
-	golang.org/x/term v0.32.0 // indirect
 )
@@ -0,0 +1,274 @@
+package history
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// the number of runs kept in the history file
+const maxRuns = 100
+
+// state is kept in .tsk/ next to the taskfile
+const stateDir = ".tsk"
+
+// a single invocation of tsk
+type Run struct {
+	Tasks     []string  `json:"tasks"`
+	CliArgs   Args      `json:"cli_args"`
+	Pure      bool      `json:"pure,omitempty"`
+	KeepGoing bool      `json:"keep_going,omitempty"`
+	Start     time.Time `json:"start"`
+	End       time.Time `json:"end"`
+	ExitCode  int       `json:"exit_code"`
+	Results   []Result  `json:"results"`
+
+	// the params given for each task, keyed by task
+	Params map[string]map[string]string `json:"params,omitempty"`
+
+	// each task ran in every included taskfile that defines it
+	All bool `json:"all,omitempty"`
+
+	// globs passed with --pure-passthrough
+	PurePassthrough []string `json:"pure_passthrough,omitempty"`
+
+	// the task that failed the run, if any
+	Failed string `json:"failed,omitempty"`
+
+	// taskfiles given with -f, absolute unless read from stdin
+	TaskFiles []string `json:"task_files,omitempty"`
+
+	// a hash of the contents of every file the taskfile was loaded from at the
+	// time of the run
+	TaskFileHash string `json:"task_file_hash"`
+
+	// the parts of the environment tsk was invoked with that a resumed run
+	// restores. only kept for the most recent run, which is the only one that
+	// can be resumed
+	Env []string `json:"env,omitempty"`
+}
+
+// the outcome of a task that ran as part of a Run, including deps
+type Result struct {
+	Task     string    `json:"task"`
+	Start    time.Time `json:"start"`
+	End      time.Time `json:"end"`
+	ExitCode int       `json:"exit_code"`
+}
+
+// the path to the history file for the taskfile in dir
+func Path(dir string) string {
+	return filepath.Join(dir, stateDir, "history.json")
+}
+
+// reads the recorded runs, oldest first. a missing history file is empty
+func Load(dir string) ([]Run, error) {
+	data, err := os.ReadFile(Path(dir))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var runs []Run
+	if err := json.Unmarshal(data, &runs); err != nil {
+		return nil, fmt.Errorf("couldn't parse %s: %w", Path(dir), err)
+	}
+	return runs, nil
+}
+
+// the most recent run, or an error if nothing has been recorded
+func Last(dir string) (*Run, error) {
+	runs, err := Load(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(runs) == 0 {
+		return nil, fmt.Errorf("no runs recorded in %s", Path(dir))
+	}
+	return &runs[len(runs)-1], nil
+}
+
+// records run, dropping the oldest runs past maxRuns
+func Append(dir string, run Run) error {
+	runs, err := Load(dir)
+	if err != nil {
+		return err
+	}
+
+	for i := range runs {
+		runs[i].Env = nil
+	}
+	runs = append(runs, run)
+	if len(runs) > maxRuns {
+		runs = runs[len(runs)-maxRuns:]
+	}
+
+	data, err := json.MarshalIndent(runs, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := initStateDir(dir); err != nil {
+		return err
+	}
+
+	// write to a temp file first so concurrent invocations can't leave a
+	// partially written history behind
+	tmp, err := os.CreateTemp(filepath.Join(dir, stateDir), "history-*.json")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), Path(dir))
+}
+
+// the tasks that failed, in the order they ran
+func (r *Run) FailedTasks() []string {
+	var failed []string
+	for _, result := range r.Results {
+		if result.ExitCode != 0 {
+			failed = append(failed, result.Task)
+		}
+	}
+	return failed
+}
+
+// the tasks that completed successfully, in the order they ran
+func (r *Run) SucceededTasks() []string {
+	var succeeded []string
+	for _, result := range r.Results {
+		if result.ExitCode == 0 {
+			succeeded = append(succeeded, result.Task)
+		}
+	}
+	return succeeded
+}
+
+// the command line that started the run
+func (r *Run) Command() string {
+	cmd := "tsk"
+	for _, file := range r.TaskFiles {
+		cmd += " -f " + quote(file)
+	}
+	if r.Pure {
+		cmd += " --pure"
+	}
+	if len(r.PurePassthrough) > 0 {
+		cmd += " --pure-passthrough " + strings.Join(r.PurePassthrough, ",")
+	}
+	if r.KeepGoing {
+		cmd += " --keep-going"
+	}
+	if r.All {
+		cmd += " --all"
+	}
+	for _, task := range r.Tasks {
+		cmd += " " + quote(task)
+
+		params := r.Params[task]
+		names := make([]string, 0, len(params))
+		for name := range params {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			cmd += fmt.Sprintf(" %s=%s", name, params[name])
+		}
+	}
+	if len(r.CliArgs) > 0 {
+		cmd += " --"
+		for _, arg := range r.CliArgs {
+			cmd += " " + quote(arg)
+		}
+	}
+	return cmd
+}
+
+// the args after --. runs recorded before args were kept as a list have them
+// as a single string, which is split on whitespace
+type Args []string
+
+func (a *Args) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		*a = strings.Fields(s)
+		return nil
+	}
+	return json.Unmarshal(data, (*[]string)(a))
+}
+
+// arg quoted for display in a command line
+func quote(arg string) string {
+	quoted, err := syntax.Quote(arg, syntax.LangBash)
+	if err != nil {
+		return arg
+	}
+	return quoted
+}
+
+// prints runs as a table, most recent last
+func Print(w io.Writer, runs []Run) {
+	for _, run := range runs {
+		status := "ok"
+		if run.Failed != "" {
+			status = fmt.Sprintf("failed (%s, exit %d)", run.Failed, run.ExitCode)
+		} else if run.ExitCode != 0 {
+			status = fmt.Sprintf("failed (exit %d)", run.ExitCode)
+		}
+		fmt.Fprintf(w, "%s  %8s  %s  %s\n",
+			run.Start.Local().Format(time.DateTime),
+			run.End.Sub(run.Start).Round(time.Millisecond),
+			run.Command(),
+			status,
+		)
+	}
+}
+
+// a hash of the files' contents, used to detect changes between runs
+func HashFiles(paths []string) (string, error) {
+	hash := sha256.New()
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(hash, "%d\x00", len(data))
+		hash.Write(data)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// creates the state dir, readable only by the user, along with a .gitignore so
+// it's never committed
+func initStateDir(dir string) error {
+	path := filepath.Join(dir, stateDir)
+	if err := os.MkdirAll(path, 0700); err != nil {
+		return err
+	}
+
+	gitignore := filepath.Join(path, ".gitignore")
+	if _, err := os.Stat(gitignore); errors.Is(err, fs.ErrNotExist) {
+		return os.WriteFile(gitignore, []byte("*\n"), 0644)
+	}
+	return nil
+}
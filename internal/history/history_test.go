@@ -0,0 +1,173 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAppendAndLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	if _, err := Last(dir); err == nil {
+		t.Error("expected an error when no runs are recorded, got nil")
+	}
+
+	for _, task := range []string{"one", "two"} {
+		if err := Append(dir, Run{Tasks: []string{task}}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+
+	runs, err := Load(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+
+	last, err := Last(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if last.Tasks[0] != "two" {
+		t.Errorf("expected the last run to be 'two', got %v", last.Tasks)
+	}
+
+	// the state dir shouldn't be committed
+	if _, err := os.Stat(filepath.Join(dir, stateDir, ".gitignore")); err != nil {
+		t.Errorf("expected .tsk/.gitignore to exist, got: %v", err)
+	}
+
+	// runs hold env values, so the state dir is private
+	if info, err := os.Stat(filepath.Join(dir, stateDir)); err != nil || info.Mode().Perm() != 0700 {
+		t.Errorf("expected .tsk to be created with 0700, got %v (%v)", info.Mode().Perm(), err)
+	}
+}
+
+func TestAppendTruncates(t *testing.T) {
+	dir := t.TempDir()
+	for i := 0; i < maxRuns+5; i++ {
+		if err := Append(dir, Run{ExitCode: i}); err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+	}
+
+	runs, _ := Load(dir)
+	if len(runs) != maxRuns {
+		t.Fatalf("expected %d runs, got %d", maxRuns, len(runs))
+	}
+	if runs[0].ExitCode != 5 {
+		t.Errorf("expected the oldest runs to be dropped, first run is %d", runs[0].ExitCode)
+	}
+}
+
+func TestFailedTasks(t *testing.T) {
+	run := Run{
+		Results: []Result{
+			{Task: "lint", ExitCode: 1},
+			{Task: "build", ExitCode: 0},
+			{Task: "test", ExitCode: 2},
+		},
+	}
+
+	failed := run.FailedTasks()
+	if len(failed) != 2 || failed[0] != "lint" || failed[1] != "test" {
+		t.Errorf("expected [lint test], got %v", failed)
+	}
+}
+
+func TestCommand(t *testing.T) {
+	run := Run{
+		Tasks:           []string{"deploy"},
+		Params:          map[string]map[string]string{"deploy": {"replicas": "3", "env": "prod"}},
+		CliArgs:         Args{"--region", "us-east-1", "a b"},
+		Pure:            true,
+		PurePassthrough: []string{"PATH", "LANG*"},
+	}
+
+	expected := "tsk --pure --pure-passthrough PATH,LANG* deploy env=prod replicas=3 -- --region us-east-1 'a b'"
+	if run.Command() != expected {
+		t.Errorf("expected %q, got %q", expected, run.Command())
+	}
+
+	run = Run{Tasks: []string{"services/*:test", "lint"}, All: true}
+	expected = "tsk --all 'services/*:test' lint"
+	if run.Command() != expected {
+		t.Errorf("expected %q, got %q", expected, run.Command())
+	}
+
+	run = Run{Tasks: []string{"build"}, TaskFiles: []string{"/src/tasks.toml", "-"}}
+	expected = "tsk -f /src/tasks.toml -f - build"
+	if run.Command() != expected {
+		t.Errorf("expected %q, got %q", expected, run.Command())
+	}
+}
+
+func TestOnlyLastRunKeepsEnv(t *testing.T) {
+	dir := t.TempDir()
+	Append(dir, Run{Env: []string{"FOO=one"}})
+	Append(dir, Run{Env: []string{"FOO=two"}})
+
+	runs, _ := Load(dir)
+	if runs[0].Env != nil {
+		t.Errorf("expected older runs to drop their env, got %v", runs[0].Env)
+	}
+	if len(runs[1].Env) != 1 || runs[1].Env[0] != "FOO=two" {
+		t.Errorf("expected the last run to keep its env, got %v", runs[1].Env)
+	}
+}
+
+func TestSucceededTasks(t *testing.T) {
+	run := Run{
+		Results: []Result{
+			{Task: "one", ExitCode: 0},
+			{Task: "two", ExitCode: 1},
+		},
+	}
+
+	succeeded := run.SucceededTasks()
+	if len(succeeded) != 1 || succeeded[0] != "one" {
+		t.Errorf("expected [one], got %v", succeeded)
+	}
+}
+
+func TestHashFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tasks.toml")
+	included := filepath.Join(dir, "included.toml")
+	os.WriteFile(path, []byte("[tasks.a]\n"), 0644)
+	os.WriteFile(included, []byte("[tasks.b]\n"), 0644)
+
+	before, err := HashFiles([]string{path, included})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// a change to any of the files changes the hash
+	os.WriteFile(included, []byte("[tasks.c]\n"), 0644)
+	after, _ := HashFiles([]string{path, included})
+	if before == after {
+		t.Error("expected the hash to change with the files' contents")
+	}
+
+	if _, err := HashFiles([]string{filepath.Join(dir, "missing.toml")}); err == nil {
+		t.Error("expected an error for a missing file, got nil")
+	}
+}
+
+func TestLoadStringCliArgs(t *testing.T) {
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, ".tsk"), 0755)
+	os.WriteFile(Path(dir), []byte(`[{"tasks": ["deploy"], "cli_args": "--region us-east-1"}]`), 0644)
+
+	runs, err := Load(dir)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if strings.Join(runs[0].CliArgs, ",") != "--region,us-east-1" {
+		t.Errorf("expected the args to be split, got %q", runs[0].CliArgs)
+	}
+}
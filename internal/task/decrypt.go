@@ -0,0 +1,49 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// the only supported value of a dotenv file's `decrypt` option
+const decryptAge = "age"
+
+// the age identity used when a dotenv file doesn't set one
+func defaultAgeIdentity() string {
+	return filepath.Join(configDir(), "tsk", "key.txt")
+}
+
+// decrypts the contents of an age encrypted file, armored or not, in memory
+// using the identities in identityFile
+func ageDecrypt(content []byte, identityFile string) ([]byte, error) {
+	keys, err := os.ReadFile(identityFile)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("age identity file %s not found", identityFile)
+	} else if err != nil {
+		return nil, err
+	}
+
+	identities, err := age.ParseIdentities(bytes.NewReader(keys))
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse age identity file %s: %w", identityFile, err)
+	}
+
+	var src io.Reader = bytes.NewReader(content)
+	if bytes.HasPrefix(bytes.TrimSpace(content), []byte(armor.Header)) {
+		src = armor.NewReader(bytes.NewReader(bytes.TrimSpace(content)))
+	}
+
+	r, err := age.Decrypt(src, identities...)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
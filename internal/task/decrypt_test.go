@@ -0,0 +1,133 @@
+package task
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"filippo.io/age"
+	"filippo.io/age/armor"
+)
+
+// writes an age identity to dir and returns its path along with the identity
+func writeAgeIdentity(t *testing.T, dir string) (string, *age.X25519Identity) {
+	t.Helper()
+	identity, err := age.GenerateX25519Identity()
+	if err != nil {
+		t.Fatalf("failed to generate identity: %v", err)
+	}
+	path := filepath.Join(dir, "key.txt")
+	if err := os.WriteFile(path, []byte(identity.String()+"\n"), 0600); err != nil {
+		t.Fatalf("failed to write identity: %v", err)
+	}
+	return path, identity
+}
+
+func encryptAge(t *testing.T, plaintext string, recipient age.Recipient, armored bool) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var dst io.WriteCloser = nopWriteCloser{&buf}
+	if armored {
+		dst = armor.NewWriter(&buf)
+	}
+
+	w, err := age.Encrypt(dst, recipient)
+	if err != nil {
+		t.Fatalf("failed to encrypt: %v", err)
+	}
+	io.WriteString(w, plaintext)
+	w.Close()
+	dst.Close()
+	return buf.Bytes()
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
+
+func TestEncryptedDotEnv(t *testing.T) {
+	for _, armored := range []bool{false, true} {
+		dir := t.TempDir()
+		keyPath, identity := writeAgeIdentity(t, dir)
+		os.WriteFile(filepath.Join(dir, ".env.enc"), encryptAge(t, "TOKEN=s3cr3t\n", identity.Recipient(), armored), 0644)
+
+		files := DotEnvFiles{{Path: ".env.enc", Decrypt: "age", Identity: keyPath}}
+		layers, err := files.layers(dir, "dotenv", io.Discard)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+
+		vars := layers[0].vars
+		if len(vars) != 1 || vars[0].Name != "TOKEN" || vars[0].Value != "s3cr3t" {
+			t.Errorf("expected TOKEN=s3cr3t (armored: %t), got %v", armored, vars)
+		}
+		if !vars[0].Secret {
+			t.Errorf("expected values from an encrypted file to be secret")
+		}
+	}
+}
+
+func TestEncryptedDotEnvDefaultIdentity(t *testing.T) {
+	configHome := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", configHome)
+	os.MkdirAll(filepath.Join(configHome, "tsk"), 0755)
+	_, identity := writeAgeIdentity(t, filepath.Join(configHome, "tsk"))
+
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".env.enc"), encryptAge(t, "TOKEN=s3cr3t\n", identity.Recipient(), true), 0644)
+
+	layers, err := DotEnvFiles{{Path: ".env.enc", Decrypt: "age"}}.layers(dir, "dotenv", io.Discard)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if layers[0].vars[0].Value != "s3cr3t" {
+		t.Errorf("expected s3cr3t, got %v", layers[0].vars)
+	}
+}
+
+func TestEncryptedDotEnvErrors(t *testing.T) {
+	dir := t.TempDir()
+	_, identity := writeAgeIdentity(t, dir)
+	os.WriteFile(filepath.Join(dir, ".env.enc"), encryptAge(t, "TOKEN=s3cr3t\n", identity.Recipient(), false), 0644)
+
+	otherDir := t.TempDir()
+	otherKey, _ := writeAgeIdentity(t, otherDir)
+
+	tests := []struct {
+		name     string
+		identity string
+		expected string
+	}{
+		{"missing identity", filepath.Join(dir, "missing.txt"), "age identity file " + filepath.Join(dir, "missing.txt") + " not found"},
+		{"wrong identity", otherKey, "no identity matched"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			// an optional file that can't be decrypted is still an error
+			files := DotEnvFiles{{Path: ".env.enc", Decrypt: "age", Identity: test.identity}}
+			_, err := files.layers(dir, "dotenv", io.Discard)
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("expected an error containing %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestExpandHome(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	tests := map[string]string{
+		"~/.config/tsk/key.txt": filepath.Join(home, ".config/tsk/key.txt"),
+		"~":                     home,
+		"key.txt":               "key.txt",
+		"/abs/~/key.txt":        "/abs/~/key.txt",
+	}
+	for path, expected := range tests {
+		if got := expandHome(path); got != expected {
+			t.Errorf("expected %s, got %s", expected, got)
+		}
+	}
+}
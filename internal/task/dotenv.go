@@ -0,0 +1,173 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// a dotenv file to load into the env
+type DotEnvFile struct {
+	Path string `toml:"path"`
+	// a missing required file is an error rather than a warning
+	Required bool `toml:"required"`
+	// the file's values are masked in output
+	Secret bool `toml:"secret"`
+	// how the file is encrypted, if it is. only "age" is supported
+	Decrypt string `toml:"decrypt"`
+	// the age identity file used to decrypt the file, defaulting to
+	// ~/.config/tsk/key.txt
+	Identity string `toml:"identity"`
+}
+
+// dotenv files loaded in order, later files overriding earlier ones. in a
+// taskfile this is a path, a table with a path, or a list of either:
+//
+//	dotenv = [".env", ".env.local", { path = ".env.ci", required = true }]
+//
+// encrypted files are decrypted in memory, so the plaintext never touches disk:
+//
+//	dotenv = { path = ".env.enc", decrypt = "age", identity = "~/.config/tsk/key.txt" }
+type DotEnvFiles []DotEnvFile
+
+// reads each file into its own env layer. paths are relative to dir, and a
+// warning for each optional file that can't be loaded is written to stderr
+func (files DotEnvFiles) layers(dir, source string, stderr io.Writer) ([]envLayer, error) {
+	var layers []envLayer
+	for _, file := range files {
+		path := filepath.Join(dir, file.Path)
+
+		content, err := os.ReadFile(path)
+		if err == nil && file.Decrypt != "" {
+			// a file that's there but can't be decrypted is always an error
+			if content, err = file.decrypt(content, dir); err != nil {
+				return nil, fmt.Errorf("couldn't decrypt dotenv file %s: %w", path, err)
+			}
+		}
+
+		var env map[string]string
+		if err == nil {
+			env, err = parseDotEnv(content)
+		}
+		if err != nil {
+			if file.Required {
+				if errors.Is(err, fs.ErrNotExist) {
+					return nil, fmt.Errorf("required dotenv file %s not found", path)
+				}
+				return nil, fmt.Errorf("couldn't load required dotenv file %s: %w", path, err)
+			}
+
+			// an optional dotenv file missing is non-fatal. log a warning and continue
+			fmt.Fprintf(stderr, "Warning: Could not load dotenv file %s: %v\n", path, err)
+			continue
+		}
+
+		vars := envVarsFromMap(env, fmt.Sprintf("%s %s", source, path))
+		for i := range vars {
+			// values from encrypted files are always masked
+			vars[i].Secret = file.Secret || file.Decrypt != ""
+		}
+		layers = append(layers, envLayer{vars: vars})
+	}
+	return layers, nil
+}
+
+// decrypts the file's contents. a relative identity is relative to dir
+func (file DotEnvFile) decrypt(content []byte, dir string) ([]byte, error) {
+	identity := expandHome(file.Identity)
+	if identity == "" {
+		identity = defaultAgeIdentity()
+	} else if !filepath.IsAbs(identity) {
+		identity = filepath.Join(dir, identity)
+	}
+	return ageDecrypt(content, identity)
+}
+
+func (files DotEnvFiles) String() string {
+	paths := make([]string, 0, len(files))
+	for _, file := range files {
+		var flags []string
+		if file.Required {
+			flags = append(flags, "required")
+		}
+		if file.Secret {
+			flags = append(flags, "secret")
+		}
+		if file.Decrypt != "" {
+			flags = append(flags, "decrypt: "+file.Decrypt)
+		}
+
+		if len(flags) > 0 {
+			paths = append(paths, fmt.Sprintf("%s (%s)", file.Path, strings.Join(flags, ", ")))
+		} else {
+			paths = append(paths, file.Path)
+		}
+	}
+	return strings.Join(paths, ", ")
+}
+
+func (files *DotEnvFiles) UnmarshalTOML(data any) error {
+	list, ok := data.([]any)
+	if !ok {
+		list = []any{data}
+	}
+
+	*files = nil
+	for _, item := range list {
+		// an empty path means no dotenv, as it always has
+		if item == "" {
+			continue
+		}
+
+		var file DotEnvFile
+		if err := file.UnmarshalTOML(item); err != nil {
+			return err
+		}
+		*files = append(*files, file)
+	}
+	return nil
+}
+
+func (file *DotEnvFile) UnmarshalTOML(data any) error {
+	switch data := data.(type) {
+	case string:
+		file.Path = data
+	case map[string]any:
+		for key, value := range data {
+			var ok bool
+			switch key {
+			case "path":
+				file.Path, ok = value.(string)
+			case "required":
+				file.Required, ok = value.(bool)
+			case "secret":
+				file.Secret, ok = value.(bool)
+			case "decrypt":
+				file.Decrypt, ok = value.(string)
+				if ok && file.Decrypt != decryptAge {
+					return fmt.Errorf("unsupported dotenv decrypt method %q, only %q is supported", file.Decrypt, decryptAge)
+				}
+			case "identity":
+				file.Identity, ok = value.(string)
+			default:
+				return fmt.Errorf("unknown dotenv option %q", key)
+			}
+			if !ok {
+				return fmt.Errorf("invalid value for dotenv option %q: %v", key, value)
+			}
+		}
+		if file.Path == "" {
+			return fmt.Errorf("dotenv tables require a path")
+		}
+		if file.Identity != "" && file.Decrypt == "" {
+			return fmt.Errorf("dotenv file %s has an identity but no decrypt method", file.Path)
+		}
+	default:
+		return fmt.Errorf("dotenv must be a path, a table or a list of them, got %T", data)
+	}
+	return nil
+}
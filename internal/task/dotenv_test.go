@@ -0,0 +1,142 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDecodeDotEnvFiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		toml     string
+		expected DotEnvFiles
+	}{
+		{
+			name:     "string",
+			toml:     `dotenv = ".env"`,
+			expected: DotEnvFiles{{Path: ".env"}},
+		},
+		{
+			name:     "empty string",
+			toml:     `dotenv = ""`,
+			expected: nil,
+		},
+		{
+			name:     "table",
+			toml:     `dotenv = { path = ".env.ci", required = true }`,
+			expected: DotEnvFiles{{Path: ".env.ci", Required: true}},
+		},
+		{
+			name:     "list",
+			toml:     `dotenv = [".env", { path = ".env.ci", required = true }]`,
+			expected: DotEnvFiles{{Path: ".env"}, {Path: ".env.ci", Required: true}},
+		},
+		{
+			name:     "encrypted",
+			toml:     `dotenv = { path = ".env.enc", decrypt = "age", identity = "~/key.txt" }`,
+			expected: DotEnvFiles{{Path: ".env.enc", Decrypt: "age", Identity: "~/key.txt"}},
+		},
+		{
+			name:     "secret",
+			toml:     `dotenv = { path = ".env.secrets", secret = true }`,
+			expected: DotEnvFiles{{Path: ".env.secrets", Secret: true}},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tasks.toml")
+			os.WriteFile(path, []byte(test.toml), 0644)
+
+			config, err := NewTaskConfig(path)
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if len(config.DotEnv) != len(test.expected) {
+				t.Fatalf("expected %v, got %v", test.expected, config.DotEnv)
+			}
+			for i := range test.expected {
+				if config.DotEnv[i] != test.expected[i] {
+					t.Errorf("expected %v, got %v", test.expected[i], config.DotEnv[i])
+				}
+			}
+		})
+	}
+}
+
+func TestDecodeDotEnvFilesErrors(t *testing.T) {
+	for _, value := range []string{`{ required = true }`, `{ path = ".env", nope = 1 }`, `1`, `{ path = ".env", decrypt = "gpg" }`, `{ path = ".env", identity = "key.txt" }`} {
+		path := filepath.Join(t.TempDir(), "tasks.toml")
+		os.WriteFile(path, []byte("dotenv = "+value), 0644)
+
+		if _, err := NewTaskConfig(path); err == nil {
+			t.Errorf("expected an error for dotenv = %s, got nil", value)
+		}
+	}
+}
+
+// later files override earlier ones and missing optional files are skipped
+func TestDotEnvFilesLayering(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("A=1\nB=1\n"), 0644)
+	os.WriteFile(filepath.Join(dir, ".env.local"), []byte("B=2\n"), 0644)
+
+	pure := true
+	task := Task{
+		Dir:    dir,
+		Pure:   &pure,
+		DotEnv: DotEnvFiles{{Path: ".env"}, {Path: ".env.local"}, {Path: ".env.missing"}},
+	}
+
+	env, err := task.CompileEnv(nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	joined := strings.Join(env, " ")
+	if !strings.Contains(joined, "A=1") || !strings.Contains(joined, "B=2") {
+		t.Errorf("expected A=1 and B=2, got %v", env)
+	}
+}
+
+func TestRequiredDotEnvFile(t *testing.T) {
+	task := Task{
+		Dir:    t.TempDir(),
+		DotEnv: DotEnvFiles{{Path: ".env.ci", Required: true}},
+	}
+
+	_, err := task.CompileEnv(nil)
+	if err == nil || !strings.Contains(err.Error(), "required dotenv file") {
+		t.Errorf("expected an error for a missing required dotenv file, got %v", err)
+	}
+}
+
+// the warning for a missing optional file goes to the executor's stderr
+func TestMissingDotEnvFileWarning(t *testing.T) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	exec := Executor{
+		Stdout: stdout,
+		Stderr: stderr,
+		Config: &Config{
+			TaskFileDir: t.TempDir(),
+			DotEnv:      DotEnvFiles{{Path: ".env.top"}},
+			Tasks: map[string]Task{
+				"default": {DotEnv: DotEnvFiles{{Path: ".env.task"}}, Cmds: []string{"true"}},
+			},
+		},
+	}
+
+	if err := exec.RunTasks(exec.Config, &[]string{"default"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	for _, file := range []string{".env.top", ".env.task"} {
+		if !strings.Contains(stderr.String(), "Could not load dotenv file") || !strings.Contains(stderr.String(), file) {
+			t.Errorf("expected a warning for %s on stderr, got %q", file, stderr.String())
+		}
+	}
+}
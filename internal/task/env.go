@@ -0,0 +1,522 @@
+package task
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"mvdan.cc/sh/v3/expand"
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// a value in an env table. either a string, or a table with a shell command
+// whose trimmed output is the value: `{ sh = "git rev-parse --short HEAD" }`
+type EnvValue struct {
+	Value string
+	Sh    string
+}
+
+// a variable in a compiled env along with where it was defined
+type EnvVar struct {
+	Name   string
+	Value  string
+	Source string
+	// the command that produced the value, if any
+	Sh string
+	// the value is masked in output
+	Secret bool
+}
+
+// how env values are evaluated
+type envOptions struct {
+	// referencing an undefined variable is an error
+	strict bool
+	// globs of parent env vars that pure tasks inherit, besides USER and HOME
+	passthrough []string
+	// the names of vars whose values are masked in output
+	secrets []string
+	// runs the command of an `sh` value in dir, returning its trimmed output
+	sh func(cmd, dir string, env []string) (string, error)
+	// where warnings, like a missing dotenv file, are written
+	stderr io.Writer
+}
+
+// memoizes the output of `sh` env values so each command runs once per run,
+// however many tasks use it
+type shCache struct {
+	mu      sync.Mutex
+	results map[string]*shResult
+}
+
+type shResult struct {
+	once  sync.Once
+	value string
+	err   error
+}
+
+// a set of vars defined in one place, e.g. the top-level env
+type envLayer struct {
+	vars []EnvVar
+	// raw layers, like the parent env, aren't expanded
+	raw bool
+	// where `sh` values run
+	dir string
+}
+
+// sets the top-level env
+func (c *Config) CompileEnv() ([]string, error) {
+	opts := (&Executor{Stderr: os.Stderr}).envOptions(c)
+	layers, err := c.compileEnv(opts.stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	parent := envLayer{vars: envVarsFromStrings(os.Environ(), "parent env"), raw: true}
+	env, err := expandLayers(append([]envLayer{parent}, layers...), opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// the parent env was only needed for expansion
+	return envVarsToStrings(resolveEnv(env[len(parent.vars):])), nil
+}
+
+// the top-level layers of the env of a taskfile, with its templates rendered
+func (exec *Executor) topLevelEnv(file *Config) ([]envLayer, error) {
+	file, err := file.render(exec.renderer(file, "", nil))
+	if err != nil {
+		return nil, err
+	}
+	return file.compileEnv(exec.envOptions(file).stderr)
+}
+
+// the top-level layers of the env, the top-level env overriding the top-level dotenv
+func (c *Config) compileEnv(stderr io.Writer) ([]envLayer, error) {
+	layers, err := c.DotEnv.layers(c.TaskFileDir, "dotenv", stderr)
+	if err != nil {
+		return nil, err
+	}
+
+	// top-level `sh` values run in the taskfile's dir, so tasks with different
+	// dirs share their output
+	return append(layers, envLayer{vars: envVarsFromValues(c.Env, "env"), dir: c.TaskFileDir}), nil
+}
+
+// layers the task's env over the parent env and the top-level env
+func (t *Task) CompileEnv(env []string) ([]string, error) {
+	topLevel := envLayer{vars: envVarsFromStrings(env, "top-level"), raw: true}
+	opts := (&Executor{Stderr: os.Stderr}).envOptions(&Config{})
+	vars, err := t.compileEnv("", []envLayer{topLevel}, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+	return envVarsToStrings(resolveEnv(vars)), nil
+}
+
+// every definition that makes up a task's env, in order. when a variable is
+// defined more than once the later definition wins. the layers are:
+//
+//  1. the parent env, or the pure allowlist and passthrough
+//  2. the top-level dotenv files, in order
+//  3. the top-level env
+//  4. the task's dotenv files, in order
+//  5. the task's env
+//  6. the task's params
+//
+// values are expanded against, and `sh` values run with, the layers that came
+// before them.
+func (t *Task) compileEnv(name string, topLevel []envLayer, params map[string]string, opts envOptions) ([]EnvVar, error) {
+	prefix := "task"
+	if name != "" {
+		prefix = fmt.Sprintf("tasks.%s", name)
+	}
+
+	// a "pure" environment does not inherit the full parent env, but does inherit
+	// USER, HOME and anything matching the passthrough globs. otherwise it
+	// inherits the entire parent env.
+	base := envLayer{raw: true}
+	if t.isPure() {
+		vars, err := pureEnv(os.Environ(), slices.Concat(opts.passthrough, t.PurePassthrough))
+		if err != nil {
+			return nil, err
+		}
+		base.vars = vars
+	} else {
+		base.vars = envVarsFromStrings(os.Environ(), "parent env")
+	}
+
+	layers := append([]envLayer{base}, topLevel...)
+
+	dotEnvLayers, err := t.DotEnv.layers(t.Dir, prefix+".dotenv", opts.stderr)
+	if err != nil {
+		return nil, err
+	}
+	layers = append(layers, dotEnvLayers...)
+
+	layers = append(layers, envLayer{vars: envVarsFromValues(t.Env, prefix+".env"), dir: t.Dir})
+
+	// params come from the command line and are used as-is
+	layers = append(layers, envLayer{vars: paramEnvVars(params, prefix+".params"), raw: true})
+
+	env, err := expandLayers(layers, opts)
+	if err != nil {
+		return nil, err
+	}
+	return markSecrets(env, slices.Concat(opts.secrets, t.Secrets)), nil
+}
+
+// marks every definition of a var as secret when its name is one of names or
+// any of its definitions came from a secret source, e.g. a secret dotenv file
+func markSecrets(env []EnvVar, names []string) []EnvVar {
+	secret := make(map[string]bool)
+	for _, name := range names {
+		secret[name] = true
+	}
+	for _, v := range env {
+		if v.Secret {
+			secret[v.Name] = true
+		}
+	}
+
+	for i := range env {
+		env[i].Secret = secret[env[i].Name]
+	}
+	return env
+}
+
+// the values of env that are masked in output, including overridden ones
+func secretValues(env []EnvVar) []string {
+	var values []string
+	for _, v := range env {
+		if v.Secret && v.Value != "" {
+			values = append(values, v.Value)
+		}
+	}
+	return values
+}
+
+// expands the values of each layer against the layers before it, returning
+// every definition in order
+func expandLayers(layers []envLayer, opts envOptions) ([]EnvVar, error) {
+	var env []EnvVar
+	for _, layer := range layers {
+		if layer.raw {
+			env = append(env, layer.vars...)
+			continue
+		}
+
+		prev := envVarsToStrings(resolveEnv(env))
+		cfg := &expand.Config{
+			Env:     expand.ListEnviron(prev...),
+			NoUnset: opts.strict,
+		}
+		for _, v := range layer.vars {
+			var err error
+			if v.Sh != "" {
+				v.Value, err = opts.sh(v.Sh, layer.dir, prev)
+			} else {
+				v.Value, err = expandEnvValue(cfg, v.Value)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s (%s): %w", v.Name, v.Source, err)
+			}
+			env = append(env, v)
+		}
+	}
+	return env, nil
+}
+
+// the vars of env a pure task inherits: USER, HOME and those whose names
+// match one of the passthrough globs
+func pureEnv(env []string, passthrough []string) ([]EnvVar, error) {
+	vars := []EnvVar{
+		{Name: "USER", Value: os.Getenv("USER"), Source: "pure allowlist"},
+		{Name: "HOME", Value: os.Getenv("HOME"), Source: "pure allowlist"},
+	}
+
+	patterns := make([]*regexp.Regexp, len(passthrough))
+	for i, glob := range passthrough {
+		re, err := globToRegexp(glob)
+		if err != nil {
+			return nil, fmt.Errorf("pure_passthrough: %w", err)
+		}
+		patterns[i] = re
+	}
+
+	for _, v := range envVarsFromStrings(env, "") {
+		if v.Name == "USER" || v.Name == "HOME" {
+			continue
+		}
+		for i, re := range patterns {
+			if re.MatchString(v.Name) {
+				v.Source = fmt.Sprintf("pure passthrough %s", passthrough[i])
+				vars = append(vars, v)
+				break
+			}
+		}
+	}
+	return vars, nil
+}
+
+// the parent env vars kept with a run so it can be resumed with them: the ones
+// a pure task would inherit, except those named in secrets
+func (c *Config) ResumeEnv() ([]string, error) {
+	vars, err := pureEnv(os.Environ(), c.PurePassthrough)
+	if err != nil {
+		return nil, err
+	}
+	vars = slices.DeleteFunc(vars, func(v EnvVar) bool {
+		return slices.Contains(c.Secrets, v.Name)
+	})
+	return envVarsToStrings(vars), nil
+}
+
+func (exec *Executor) envOptions(config *Config) envOptions {
+	stderr := exec.Stderr
+	if stderr == nil {
+		stderr = io.Discard
+	}
+	return envOptions{
+		strict:      config.Strict,
+		passthrough: config.PurePassthrough,
+		secrets:     config.Secrets,
+		sh:          exec.shOutput,
+		stderr:      stderr,
+	}
+}
+
+// runs cmd through the interpreter and returns its trimmed output. within a
+// run, the result is cached by cmd and dir
+func (exec *Executor) shOutput(cmd, dir string, env []string) (string, error) {
+	run := func() (string, error) {
+		var out bytes.Buffer
+		if err := exec.runCommandTo(cmd, dir, env, &out); err != nil {
+			return "", fmt.Errorf("`%s`: %w", cmd, err)
+		}
+		return strings.TrimSpace(out.String()), nil
+	}
+
+	if exec.sh == nil {
+		return run()
+	}
+	return exec.sh.get(dir+"\x00"+cmd, run)
+}
+
+func newShCache() *shCache {
+	return &shCache{results: make(map[string]*shResult)}
+}
+
+// returns the cached result for key, calling fn the first time
+func (c *shCache) get(key string, fn func() (string, error)) (string, error) {
+	c.mu.Lock()
+	result, ok := c.results[key]
+	if !ok {
+		result = &shResult{}
+		c.results[key] = result
+	}
+	c.mu.Unlock()
+
+	result.once.Do(func() {
+		result.value, result.err = fn()
+	})
+	return result.value, result.err
+}
+
+// expands $VAR and ${VAR} in value the way a heredoc would. quotes, backticks
+// and backslashes are kept as-is, except that a literal $ can be written as \$
+func expandEnvValue(cfg *expand.Config, value string) (string, error) {
+	if !strings.Contains(value, "$") {
+		return value, nil
+	}
+
+	// escape what a heredoc would otherwise interpret, besides \$
+	var escaped strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == '$':
+			escaped.WriteString(`\$`)
+			i++
+		case value[i] == '\\' || value[i] == '`':
+			escaped.WriteByte('\\')
+			escaped.WriteByte(value[i])
+		default:
+			escaped.WriteByte(value[i])
+		}
+	}
+
+	word, err := syntax.NewParser().Document(strings.NewReader(escaped.String()))
+	if err != nil {
+		return "", err
+	}
+	return expand.Document(cfg, word)
+}
+
+// prints the env a task runs with and where each variable came from. when a
+// variable is defined more than once the last definition wins, the ones it
+// overrides are listed beneath it.
+func (exec *Executor) ExplainEnv(config *Config, task string) error {
+	if err := exec.VerifyTasks([]string{task}); err != nil {
+		return err
+	}
+	t, params, err := exec.renderTask(config, task, exec.Params[task])
+	if err != nil {
+		return err
+	}
+	file := config.fileOf(task)
+	if t.Dir == "" {
+		t.Dir = file.TaskFileDir
+	}
+
+	topLevel, err := exec.topLevelEnv(file)
+	if err != nil {
+		return err
+	}
+	env, err := t.compileEnv(task, topLevel, params, exec.envOptions(file))
+	if err != nil {
+		return err
+	}
+
+	// values derived from a secret contain it, so mask the output as a whole
+	out := newMaskWriter(exec.Stdout, secretValues(env))
+	printEnvExplanation(out, env)
+	return out.Flush()
+}
+
+func printEnvExplanation(w io.Writer, env []EnvVar) {
+	byName := make(map[string][]EnvVar)
+	for _, v := range env {
+		byName[v.Name] = append(byName[v.Name], v)
+	}
+
+	names := make([]string, 0, len(byName))
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		defs := byName[name]
+		winner := defs[len(defs)-1]
+		fmt.Fprintf(w, "%s=%s  (%s)\n", winner.Name, winner.displayValue(), winner.describeSource())
+		for i := len(defs) - 2; i >= 0; i-- {
+			fmt.Fprintf(w, "  overrides %s=%s  (%s)\n", defs[i].Name, defs[i].displayValue(), defs[i].describeSource())
+		}
+	}
+}
+
+// the value, masked when it's secret
+func (v EnvVar) displayValue() string {
+	if v.Secret {
+		return secretMask
+	}
+	return v.Value
+}
+
+func (v EnvVar) describeSource() string {
+	if v.Sh != "" {
+		return fmt.Sprintf("%s, sh: %s", v.Source, v.Sh)
+	}
+	return v.Source
+}
+
+// de-duplicates env keeping the last definition of each var, sorted by name
+func resolveEnv(env []EnvVar) []EnvVar {
+	byName := make(map[string]EnvVar, len(env))
+	for _, v := range env {
+		byName[v.Name] = v
+	}
+
+	resolved := make([]EnvVar, 0, len(byName))
+	for _, v := range byName {
+		resolved = append(resolved, v)
+	}
+	sort.Slice(resolved, func(i, j int) bool {
+		return resolved[i].Name < resolved[j].Name
+	})
+	return resolved
+}
+
+// converts a map of vars to EnvVars, sorted by name for a stable order
+func envVarsFromMap(env map[string]string, source string) []EnvVar {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]EnvVar, 0, len(env))
+	for _, name := range names {
+		vars = append(vars, EnvVar{Name: name, Value: env[name], Source: source})
+	}
+	return vars
+}
+
+// converts an env table to EnvVars, sorted by name for a stable order
+func envVarsFromValues(env map[string]EnvValue, source string) []EnvVar {
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	vars := make([]EnvVar, 0, len(env))
+	for _, name := range names {
+		vars = append(vars, EnvVar{Name: name, Value: env[name].Value, Sh: env[name].Sh, Source: source})
+	}
+	return vars
+}
+
+// converts KEY=value pairs to EnvVars
+func envVarsFromStrings(env []string, source string) []EnvVar {
+	vars := make([]EnvVar, 0, len(env))
+	for _, kv := range env {
+		name, value, _ := strings.Cut(kv, "=")
+		vars = append(vars, EnvVar{Name: name, Value: value, Source: source})
+	}
+	return vars
+}
+
+func envVarsToStrings(vars []EnvVar) []string {
+	env := make([]string, 0, len(vars))
+	for _, v := range vars {
+		env = append(env, fmt.Sprintf("%s=%s", v.Name, v.Value))
+	}
+	return env
+}
+
+func (v *EnvValue) UnmarshalTOML(data any) error {
+	switch data := data.(type) {
+	case string:
+		v.Value = data
+		return nil
+	case map[string]any:
+		sh, ok := data["sh"].(string)
+		if !ok || len(data) != 1 {
+			return fmt.Errorf("env tables must contain only a `sh` string, got %v", data)
+		}
+		v.Sh = sh
+		return nil
+	}
+	return fmt.Errorf("env values must be a string or a table with `sh`, got %T", data)
+}
+
+func (v EnvValue) MarshalTOML() ([]byte, error) {
+	if v.Sh != "" {
+		return []byte(fmt.Sprintf("{ sh = %s }", tomlString(v.Sh))), nil
+	}
+	return []byte(tomlString(v.Value)), nil
+}
+
+func (v EnvValue) MarshalJSON() ([]byte, error) {
+	if v.Sh != "" {
+		return json.Marshal(map[string]string{"sh": v.Sh})
+	}
+	return json.Marshal(v.Value)
+}
@@ -0,0 +1,100 @@
+package task
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// the tasks a task inherits from, in a taskfile a name or a list of names.
+// later tasks take precedence over earlier ones, and the task itself over all
+// of them
+type Extends []string
+
+func (e *Extends) UnmarshalTOML(data any) error {
+	list, ok := data.([]any)
+	if !ok {
+		list = []any{data}
+	}
+
+	*e = nil
+	for _, item := range list {
+		name, ok := item.(string)
+		if !ok || name == "" {
+			return fmt.Errorf("extends must be a task name or a list of task names, got %v", item)
+		}
+		*e = append(*e, name)
+	}
+	return nil
+}
+
+// t with the env, vars, dir, dotenv, pure, deps and cmds it doesn't set taken
+// from base. env and vars are merged, with t's taking precedence
+func (t Task) extend(base Task) Task {
+	if t.Cmds == nil {
+		t.Cmds = base.Cmds
+	}
+	if t.Deps == nil {
+		t.Deps = base.Deps
+	}
+	if t.Dir == "" {
+		t.Dir = base.Dir
+	}
+	if t.DotEnv == nil {
+		t.DotEnv = base.DotEnv
+	}
+	if t.Pure == nil {
+		t.Pure = base.Pure
+	}
+
+	if len(base.Env) > 0 {
+		env := maps.Clone(base.Env)
+		maps.Copy(env, t.Env)
+		t.Env = env
+	}
+	if len(base.Vars) > 0 {
+		vars := maps.Clone(base.Vars)
+		maps.Copy(vars, t.Vars)
+		t.Vars = vars
+	}
+	return t
+}
+
+// applies extends to the taskfile's own tasks. included tasks have already had
+// theirs applied by their own taskfile
+func (c *Config) resolveExtends() error {
+	resolved := make(map[string]bool)
+	var resolve func(name string, stack []string) error
+	resolve = func(name string, stack []string) error {
+		t := c.Tasks[name]
+		if resolved[name] || t.file != nil {
+			return nil
+		}
+		if slices.Contains(stack, name) {
+			return fmt.Errorf("extends cycle: %s", strings.Join(append(stack, name), " -> "))
+		}
+
+		var inherited Task
+		for _, base := range t.Extends {
+			if _, ok := c.Tasks[base]; !ok {
+				return fmt.Errorf("task '%s' extends '%s', which doesn't exist", name, base)
+			}
+			if err := resolve(base, append(stack, name)); err != nil {
+				return err
+			}
+			inherited = c.Tasks[base].extend(inherited)
+		}
+
+		c.Tasks[name] = t.extend(inherited)
+		resolved[name] = true
+		return nil
+	}
+
+	for _, name := range *alphabetizeTaskList(&c.Tasks) {
+		if err := resolve(name, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
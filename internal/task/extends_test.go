@@ -0,0 +1,169 @@
+package task
+
+import (
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestExtends(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+[tasks.go_base]
+abstract = true
+env = { CGO_ENABLED = "0", GOFLAGS = "-mod=mod" }
+dotenv = ".env.go"
+dir = "services"
+cmds = ["go build ./..."]
+
+[tasks.with_deps]
+abstract = true
+extends = "go_base"
+env = { VERBOSE = "1" }
+vars = { PKG = "./cmd/..." }
+deps = [["generate"]]
+
+[tasks.generate]
+cmds = ["go generate ./..."]
+
+[tasks.api]
+extends = ["go_base", "with_deps"]
+env = { GOFLAGS = "-v" }
+cmds = ["go test ./..."]
+
+[tasks.web]
+extends = "go_base"
+dir = "web"
+pure = true
+`,
+	})
+
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	api := config.Tasks["api"]
+	if !slices.Equal(api.Cmds, []string{"go test ./..."}) {
+		t.Errorf("Expected the task's own cmds to win, got %v", api.Cmds)
+	}
+	if len(api.Deps) != 1 || api.Deps[0][0] != "generate" {
+		t.Errorf("Expected deps from a later base, got %v", api.Deps)
+	}
+	if api.Dir != "services" || len(api.DotEnv) != 1 || api.DotEnv[0].Path != ".env.go" {
+		t.Errorf("Expected dir and dotenv to be inherited, got %q and %v", api.Dir, api.DotEnv)
+	}
+	expectedEnv := map[string]string{"CGO_ENABLED": "0", "GOFLAGS": "-v", "VERBOSE": "1"}
+	if len(api.Env) != len(expectedEnv) {
+		t.Errorf("Expected env %v, got %v", expectedEnv, api.Env)
+	}
+	for k, v := range expectedEnv {
+		if api.Env[k].Value != v {
+			t.Errorf("Expected %s=%s, got %q", k, v, api.Env[k].Value)
+		}
+	}
+	if api.Vars["PKG"].Value != "./cmd/..." {
+		t.Errorf("Expected vars to be inherited, got %v", api.Vars)
+	}
+	if api.Abstract {
+		t.Errorf("Expected abstract not to be inherited")
+	}
+
+	web := config.Tasks["web"]
+	if web.Dir != "web" || !web.isPure() || !slices.Equal(web.Cmds, []string{"go build ./..."}) {
+		t.Errorf("Expected web to override dir and inherit cmds, got %+v", web)
+	}
+	if config.Tasks["go_base"].Env["VERBOSE"].Value != "" {
+		t.Errorf("Expected bases to be left as-is")
+	}
+}
+
+// pure is inherited unless the task sets it, even to false
+func TestExtendsPure(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+[tasks.base]
+abstract = true
+pure = true
+
+[tasks.inherits]
+extends = "base"
+
+[tasks.impure]
+extends = "base"
+pure = false
+`,
+	})
+
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !config.Tasks["inherits"].isPure() {
+		t.Errorf("Expected pure to be inherited")
+	}
+	if config.Tasks["impure"].isPure() {
+		t.Errorf("Expected pure = false to override the base")
+	}
+}
+
+func TestExtendsErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		taskFile string
+		err      string
+	}{
+		{
+			name:     "missing base",
+			taskFile: "[tasks.a]\nextends = \"nope\"\n",
+			err:      "extends 'nope', which doesn't exist",
+		},
+		{
+			name:     "cycle",
+			taskFile: "[tasks.a]\nextends = \"b\"\n[tasks.b]\nextends = [\"a\"]\n",
+			err:      "extends cycle",
+		},
+		{
+			name:     "invalid",
+			taskFile: "[tasks.a]\nextends = 1\n",
+			err:      "extends must be a task name",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeFiles(t, dir, map[string]string{"tasks.toml": test.taskFile})
+
+			_, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("expected an error containing %q, got: %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestAbstractTasks(t *testing.T) {
+	config := &Config{Tasks: map[string]Task{
+		"base":       {Abstract: true, Cmds: []string{"true"}},
+		"uses_base":  {Deps: [][]string{{"base"}}},
+		"svc:base":   {Abstract: true},
+		"svc:test":   {Cmds: []string{"true"}},
+		"other:test": {Cmds: []string{"true"}},
+	}}
+	exec := &Executor{Config: config}
+
+	if err := exec.VerifyTasks([]string{"base"}); err == nil || !strings.Contains(err.Error(), "abstract") {
+		t.Errorf("Expected an abstract task not to run, got: %v", err)
+	}
+	if err := exec.VerifyTasks([]string{"uses_base"}); err == nil || !strings.Contains(err.Error(), "abstract") {
+		t.Errorf("Expected an abstract task not to be a dep, got: %v", err)
+	}
+	if matches := exec.MatchTasks("*:*"); !slices.Equal(matches, []string{"other:test", "svc:test"}) {
+		t.Errorf("Expected globs not to match abstract tasks, got %v", matches)
+	}
+}
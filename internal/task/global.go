@@ -0,0 +1,61 @@
+package task
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// the namespace of the tasks in the user's global taskfile
+const globalNamespace = "global"
+
+// the user's global taskfile, with personal tasks available from anywhere
+func globalTaskFile() string {
+	return filepath.Join(configDir(), "tsk", "tasks.toml")
+}
+
+// adds the tasks of the global taskfile, if there is one, as global:task. a
+// global task is also available by its own name unless the taskfile defines a
+// task with that name. global tasks that don't set a dir run in the dir tsk was
+// invoked from
+func (c *Config) includeGlobal() error {
+	path := globalTaskFile()
+	if _, err := os.Stat(path); errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	wd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	if err := c.includeFile(globalNamespace, path, Include{Path: path, Dir: wd}, nil); err != nil {
+		return err
+	}
+
+	prefix := globalNamespace + namespaceSep
+	for name, t := range c.Tasks {
+		local, ok := strings.CutPrefix(name, prefix)
+		if !ok || strings.Contains(local, namespaceSep) {
+			continue
+		}
+		if _, ok := c.Tasks[local]; !ok {
+			t.globalAlias = true
+			c.Tasks[local] = t
+		}
+	}
+	return nil
+}
+
+// a config for running tsk outside of any project, holding nothing but the
+// global taskfile's tasks
+func globalConfig() (*Config, error) {
+	path := globalTaskFile()
+	config := &Config{
+		TaskFileDir:  filepath.Dir(path),
+		TaskFilePath: path,
+		ScriptDir:    "tsk",
+	}
+	return config, config.includeGlobal()
+}
@@ -0,0 +1,107 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"testing"
+)
+
+// writes a global taskfile to a temp config dir
+func setupGlobalTaskFile(t *testing.T) {
+	t.Helper()
+	config := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", config)
+	writeFiles(t, config, map[string]string{
+		"tsk/tasks.toml": `
+[tasks.kube-ctx]
+cmds = ["kubectl config current-context"]
+
+[tasks.build]
+cmds = ["echo global build"]
+`,
+	})
+}
+
+func TestGlobalTaskFile(t *testing.T) {
+	setupGlobalTaskFile(t)
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"tasks.toml": "[tasks.build]\ncmds = [\"make\"]\n"})
+
+	config, err := NewTaskConfig(filepath.Join(dir, "tasks.toml"))
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if config.Tasks["build"].Cmds[0] != "make" {
+		t.Errorf("Expected the project's task to win a clash, got %v", config.Tasks["build"].Cmds)
+	}
+	if config.Tasks["global:build"].Cmds[0] != "echo global build" {
+		t.Errorf("Expected a clashing global task to be available as global:build")
+	}
+	for _, name := range []string{"kube-ctx", "global:kube-ctx"} {
+		if _, ok := config.Tasks[name]; !ok {
+			t.Errorf("Expected global task '%s' to be defined", name)
+		}
+	}
+
+	wd, _ := os.Getwd()
+	if config.Tasks["global:kube-ctx"].Dir != wd {
+		t.Errorf("Expected global tasks to run in the invocation dir, got %q", config.Tasks["global:kube-ctx"].Dir)
+	}
+
+	listed := filterTasks(&config.Tasks, regexp.MustCompile(".*"))
+	if _, ok := listed["kube-ctx"]; ok {
+		t.Errorf("Expected global tasks to only be listed in the global namespace")
+	}
+
+	// global tasks are only matched by globs that name their namespace
+	exec := &Executor{Config: config}
+	for pattern, expected := range map[string][]string{
+		"*":        {"build"},
+		"*:build":  nil,
+		"global:*": {"global:build", "global:kube-ctx"},
+	} {
+		if matches := exec.MatchTasks(pattern); !slices.Equal(matches, expected) {
+			t.Errorf("Expected %s to match %v, got %v", pattern, expected, matches)
+		}
+	}
+	exec.All = true
+	if matches := exec.MatchTasks("build"); len(matches) != 0 {
+		t.Errorf("Expected --all not to match global tasks, got %v", matches)
+	}
+}
+
+func TestGlobalTaskFileOutsideProject(t *testing.T) {
+	setupGlobalTaskFile(t)
+
+	cwd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(cwd)
+
+	config, err := NewTaskConfig("")
+	if err != nil {
+		t.Fatalf("Expected the global taskfile to be used, got: %v", err)
+	}
+	if config.TaskFilePath != globalTaskFile() {
+		t.Errorf("Expected the global taskfile's path, got %q", config.TaskFilePath)
+	}
+	for _, name := range []string{"build", "global:build", "kube-ctx", "global:kube-ctx"} {
+		if _, ok := config.Tasks[name]; !ok {
+			t.Errorf("Expected global task '%s' to be defined", name)
+		}
+	}
+}
+
+func TestNoTaskFile(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	cwd, _ := os.Getwd()
+	os.Chdir(t.TempDir())
+	defer os.Chdir(cwd)
+
+	if _, err := NewTaskConfig(""); err == nil {
+		t.Errorf("Expected an error without a project or global taskfile")
+	}
+}
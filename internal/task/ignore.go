@@ -0,0 +1,117 @@
+package task
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// directories that are always skipped when walking or watching a project
+var alwaysIgnoredDirs = map[string]bool{
+	".git": true,
+	".tsk": true,
+}
+
+// a parsed .gitignore. supports the commonly used subset of the syntax:
+// comments, negation, directory-only patterns and anchoring.
+type gitignore struct {
+	rules []ignoreRule
+}
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// reads the .gitignore in dir. a missing file ignores nothing
+func readGitignore(dir string) (*gitignore, error) {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return &gitignore{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return parseGitignore(f)
+}
+
+func parseGitignore(r io.Reader) (*gitignore, error) {
+	g := &gitignore{}
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " ")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+
+		// patterns containing a slash are relative to the .gitignore, the rest
+		// match at any depth
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+
+		re, err := globToRegexp(line)
+		if err != nil {
+			return nil, err
+		}
+		rule.re = re
+		g.rules = append(g.rules, rule)
+	}
+
+	return g, scanner.Err()
+}
+
+// reports whether rel, a path relative to the .gitignore's directory, is
+// ignored either directly or because one of its parent directories is
+func (g *gitignore) ignored(rel string, isDir bool) bool {
+	rel = filepath.ToSlash(rel)
+	if rel == "." || strings.HasPrefix(rel, "../") {
+		return false
+	}
+
+	parts := strings.Split(rel, "/")
+	for i := range parts {
+		if alwaysIgnoredDirs[parts[i]] && (i < len(parts)-1 || isDir) {
+			return true
+		}
+
+		last := i == len(parts)-1
+		if g.match(strings.Join(parts[:i+1], "/"), isDir || !last) {
+			return true
+		}
+	}
+	return false
+}
+
+// the last matching rule wins
+func (g *gitignore) match(path string, isDir bool) bool {
+	ignored := false
+	for _, rule := range g.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(path) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
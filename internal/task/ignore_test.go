@@ -0,0 +1,45 @@
+package task
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGitignore(t *testing.T) {
+	g, err := parseGitignore(strings.NewReader(`
+# comment
+bin/
+*.log
+/dist
+!keep.log
+`))
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		isDir   bool
+		ignored bool
+	}{
+		{"bin", true, true},
+		{"bin/tsk", false, true},
+		{"bin", false, false},
+		{"src/bin/tsk", false, true},
+		{"debug.log", false, true},
+		{"nested/debug.log", false, true},
+		{"keep.log", false, false},
+		{"dist/app", false, true},
+		{"src/dist/app", false, false},
+		{".git/HEAD", false, true},
+		{".tsk/history.json", false, true},
+		{"main.go", false, false},
+		{"../outside.log", false, false},
+	}
+
+	for _, test := range tests {
+		if got := g.ignored(test.path, test.isDir); got != test.ignored {
+			t.Errorf("ignored(%q, %t): expected %t, got %t", test.path, test.isDir, test.ignored, got)
+		}
+	}
+}
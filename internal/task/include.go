@@ -0,0 +1,332 @@
+package task
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+)
+
+// separates a namespace from the name of a task in an included taskfile, e.g.
+// docker:build
+const namespaceSep = ":"
+
+// the taskfiles included by a taskfile, keyed by namespace. in a taskfile this
+// is a table of namespaces:
+//
+//	includes = { docker = "docker/tasks.toml", web = { path = "web/tasks.toml", dir = "web" } }
+//
+// or a list of paths, which may be globs. each taskfile a path matches is
+// namespaced by its dir, relative to the including taskfile, e.g. services/api:
+//
+//	includes = ["services/*/tasks.toml"]
+type Includes map[string]Include
+
+// another taskfile whose tasks are included under a namespace. in a taskfile
+// this is a path or a table with a path
+type Include struct {
+	Path string `toml:"path"`
+	// the working directory of included tasks that don't set their own,
+	// defaulting to the included taskfile's dir
+	Dir string `toml:"dir"`
+
+	// Path is a glob from a list of includes, namespaced by each match's dir
+	glob bool
+}
+
+// parses a taskfile and the taskfiles it includes. stack is the files
+// including this one, used to detect cycles
+func loadTaskFile(taskFile string, stack []string) (*Config, error) {
+	return loadTaskFiles([]string{taskFile}, stack)
+}
+
+// parses taskfiles merged into one, see decodeTaskFiles. the first taskfile is
+// the one tasks run relative to
+func loadTaskFiles(taskFiles []string, stack []string) (*Config, error) {
+	taskFile := taskFiles[0]
+	abs, err := filepath.Abs(taskFile)
+	if err != nil {
+		return nil, err
+	}
+	if slices.Contains(stack, abs) {
+		return nil, fmt.Errorf("include cycle: %s", strings.Join(append(stack, abs), " -> "))
+	}
+
+	// parse the task file. templates are rendered for each task when it runs
+	var config Config
+	overlays, err := decodeTaskFiles(taskFiles, &config)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(config.TemplateDelims) > 0 && (len(config.TemplateDelims) != 2 || slices.Contains(config.TemplateDelims, "")) {
+		return nil, fmt.Errorf(`template_delims must be a pair of delimiters, like ["[[", "]]"]`)
+	}
+	if err := config.verifyParamNames(); err != nil {
+		return nil, err
+	}
+
+	// set the task file dir, used as the base for a task's working directory
+	config.TaskFileDir = filepath.Dir(taskFile)
+	config.TaskFilePath = taskFile
+	config.Overlays = overlays
+
+	// set the script dir
+	if len(config.ScriptDir) == 0 {
+		config.ScriptDir = "tsk"
+	}
+
+	if err := config.include(append(stack, abs)); err != nil {
+		return nil, err
+	}
+	if err := config.resolveExtends(); err != nil {
+		return nil, err
+	}
+	return &config, nil
+}
+
+// adds the tasks of each included taskfile as namespace:task. included tasks
+// keep their own taskfile's context: its dir, script_dir, env and dotenv. their
+// deps refer to tasks in the same file first, then to tasks in this one
+func (c *Config) include(stack []string) error {
+	namespaces := make([]string, 0, len(c.Includes))
+	for ns := range c.Includes {
+		namespaces = append(namespaces, ns)
+	}
+	sort.Strings(namespaces)
+
+	for _, ns := range namespaces {
+		inc := c.Includes[ns]
+		if !inc.glob {
+			if err := c.includeFile(ns, c.path(inc.Path), inc, stack); err != nil {
+				return err
+			}
+			continue
+		}
+
+		matches, err := filepath.Glob(c.path(inc.Path))
+		if err != nil {
+			return fmt.Errorf("include %s: %w", inc.Path, err)
+		}
+		for _, match := range matches {
+			dir, err := filepath.Rel(c.TaskFileDir, filepath.Dir(match))
+			if err != nil {
+				return fmt.Errorf("include %s: %w", match, err)
+			}
+			if err := c.includeFile(filepath.ToSlash(dir), match, inc, stack); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// adds the tasks of the taskfile at path as ns:task
+func (c *Config) includeFile(ns, path string, inc Include, stack []string) error {
+	if ns == "" || ns == "." || strings.Contains(ns, namespaceSep) {
+		return fmt.Errorf("invalid include name %q", ns)
+	}
+
+	included, err := loadTaskFile(path, stack)
+	if err != nil {
+		return fmt.Errorf("include %s: %w", ns, err)
+	}
+	c.included = append(c.included, included.Files()...)
+
+	if c.Tasks == nil {
+		c.Tasks = make(map[string]Task)
+	}
+	for name, t := range included.Tasks {
+		// the included file's own tasks, rather than ones it included itself
+		if t.file == nil {
+			t.file, t.localName = included, name
+			if t.Dir != "" && !filepath.IsAbs(t.Dir) {
+				t.Dir = filepath.Join(included.TaskFileDir, t.Dir)
+			}
+		}
+		if t.Dir == "" && inc.Dir != "" {
+			t.Dir = c.path(inc.Dir)
+		}
+
+		t.Deps = namespaceDeps(t.Deps, ns, included.Tasks)
+
+		full := ns + namespaceSep + name
+		if _, ok := c.Tasks[full]; ok {
+			return fmt.Errorf("task '%s' is defined in %s and included from %s", full, c.TaskFilePath, included.TaskFilePath)
+		}
+		c.Tasks[full] = t
+	}
+	return nil
+}
+
+// path relative to the taskfile's dir
+func (c *Config) path(path string) string {
+	if filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(c.TaskFileDir, path)
+}
+
+// prefixes deps that are tasks in the included file with its namespace
+func namespaceDeps(deps [][]string, ns string, tasks map[string]Task) [][]string {
+	if deps == nil {
+		return nil
+	}
+	namespaced := make([][]string, len(deps))
+	for i, group := range deps {
+		namespaced[i] = make([]string, len(group))
+		for j, dep := range group {
+			if _, ok := tasks[dep]; ok {
+				dep = ns + namespaceSep + dep
+			}
+			namespaced[i][j] = dep
+		}
+	}
+	return namespaced
+}
+
+// the config of the taskfile a task was defined in
+func (c *Config) fileOf(task string) *Config {
+	if t, ok := c.Tasks[task]; ok && t.file != nil {
+		return t.file
+	}
+	return c
+}
+
+// the path of the script a task without cmds runs, in its taskfile's script_dir
+func (c *Config) script(task string) string {
+	name := task
+	if t, ok := c.Tasks[task]; ok && t.localName != "" {
+		name = t.localName
+	}
+	return fmt.Sprintf("%s/%s", c.fileOf(task).ScriptDir, name)
+}
+
+// the namespace of a task, empty for tasks in the root taskfile
+func namespace(task string) string {
+	if i := strings.LastIndex(task, namespaceSep); i >= 0 {
+		return task[:i]
+	}
+	return ""
+}
+
+// task names sorted by namespace, the root taskfile's tasks first, then by name
+func namespaceOrder(tasks map[string]Task) []string {
+	names := *alphabetizeTaskList(&tasks)
+	sort.SliceStable(names, func(i, j int) bool {
+		return namespace(names[i]) < namespace(names[j])
+	})
+	return names
+}
+
+// the tasks a task given on the command line refers to: every task a glob like
+// services/*:test matches, every included task named task with All, or the
+// task itself. the user's global tasks are only matched by a glob that names
+// the global namespace, like global:*
+func (exec *Executor) MatchTasks(task string) []string {
+	if !exec.expands(task) {
+		return []string{task}
+	}
+
+	match := func(name string) bool {
+		return namespace(name) != "" && strings.TrimPrefix(name, namespace(name)+namespaceSep) == task
+	}
+	if !exec.All {
+		re, err := globToRegexp(task)
+		if err != nil {
+			return nil
+		}
+		match = re.MatchString
+	}
+
+	prefix := globalNamespace + namespaceSep
+	matchGlobal := !exec.All && strings.HasPrefix(task, prefix)
+
+	var matches []string
+	for _, name := range *alphabetizeTaskList(&exec.Config.Tasks) {
+		t := exec.Config.Tasks[name]
+		if t.Abstract || t.globalAlias || (strings.HasPrefix(name, prefix) && !matchGlobal) {
+			continue
+		}
+		if match(name) {
+			matches = append(matches, name)
+		}
+	}
+	return matches
+}
+
+// reports whether task given on the command line is matched against the tasks
+// rather than naming one
+func (exec *Executor) expands(task string) bool {
+	return exec.All || isGlob(task)
+}
+
+// adds globs to the pure_passthrough of the taskfile and those it includes
+func (c *Config) AddPurePassthrough(globs []string) {
+	if len(globs) == 0 {
+		return
+	}
+	seen := map[*Config]bool{c: true}
+	c.PurePassthrough = append(c.PurePassthrough, globs...)
+	for _, t := range c.Tasks {
+		if t.file != nil && !seen[t.file] {
+			seen[t.file] = true
+			t.file.PurePassthrough = append(t.file.PurePassthrough, globs...)
+		}
+	}
+}
+
+func (i *Includes) UnmarshalTOML(data any) error {
+	*i = make(Includes)
+	switch data := data.(type) {
+	case map[string]any:
+		for ns, value := range data {
+			var inc Include
+			if err := inc.UnmarshalTOML(value); err != nil {
+				return fmt.Errorf("include %s: %w", ns, err)
+			}
+			(*i)[ns] = inc
+		}
+	case []any:
+		for _, value := range data {
+			path, ok := value.(string)
+			if !ok || path == "" {
+				return fmt.Errorf("includes must be a list of paths, got %v", value)
+			}
+			(*i)[path] = Include{Path: path, glob: true}
+		}
+	default:
+		return fmt.Errorf("includes must be a table or a list of paths, got %T", data)
+	}
+	return nil
+}
+
+func (i *Include) UnmarshalTOML(data any) error {
+	switch data := data.(type) {
+	case string:
+		i.Path = data
+	case map[string]any:
+		for key, value := range data {
+			var ok bool
+			switch key {
+			case "path":
+				i.Path, ok = value.(string)
+			case "dir":
+				i.Dir, ok = value.(string)
+			default:
+				return fmt.Errorf("unknown include option %q", key)
+			}
+			if !ok {
+				return fmt.Errorf("invalid value for include option %q: %v", key, value)
+			}
+		}
+	default:
+		return fmt.Errorf("includes must be a path or a table with a path, got %T", data)
+	}
+
+	if i.Path == "" {
+		return fmt.Errorf("includes require a path")
+	}
+	return nil
+}
@@ -0,0 +1,236 @@
+package task
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/BurntSushi/toml"
+)
+
+// writes files, keyed by path relative to dir
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+includes = { docker = "docker/tasks.toml", web = { path = "web/tasks.toml", dir = "web/public" } }
+env = { WHERE = "root" }
+
+[tasks.all]
+deps = [["docker:build"], ["web:serve"]]
+cmds = ["echo all from $WHERE"]
+`,
+		"docker/tasks.toml": `
+env = { WHERE = "docker" }
+
+[tasks.build]
+deps = [["prep"]]
+cmds = ["echo build from $WHERE in $(basename $PWD)"]
+
+[tasks.prep]
+`,
+		"docker/tsk/prep": "#!/bin/sh\necho prep script\n",
+		"web/tasks.toml": `
+[tasks.serve]
+cmds = ["echo serve in $(basename $PWD)"]
+`,
+		"web/public/.keep": "",
+	})
+
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, name := range []string{"all", "docker:build", "docker:prep", "web:serve"} {
+		if _, ok := config.Tasks[name]; !ok {
+			t.Errorf("Expected task '%s' to be defined", name)
+		}
+	}
+	if deps := config.Tasks["docker:build"].Deps; len(deps) != 1 || deps[0][0] != "docker:prep" {
+		t.Errorf("Expected deps of an included task to be namespaced, got: %v", deps)
+	}
+
+	files := []string{filepath.Join(dir, "tasks.toml"), filepath.Join(dir, "docker/tasks.toml"), filepath.Join(dir, "web/tasks.toml")}
+	if !slices.Equal(config.Files(), files) {
+		t.Errorf("Expected the config to be loaded from %v, got: %v", files, config.Files())
+	}
+
+	out := &bytes.Buffer{}
+	exec := &Executor{Config: config, Stdout: out, Stderr: out}
+	if err := exec.RunTasks(exec.Config, &[]string{"all"}); err != nil {
+		t.Fatalf("Expected no error, got: %v\n%s", err, out)
+	}
+
+	expected := "prep script\nbuild from docker in docker\nserve in public\nall from root\n"
+	if out.String() != expected {
+		t.Errorf("Expected output %q, got %q", expected, out.String())
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml":   `includes = { a = "a/tasks.toml" }`,
+		"a/tasks.toml": `includes = { b = "../b/tasks.toml" }`,
+		"b/tasks.toml": `includes = { root = "../tasks.toml" }`,
+	})
+
+	_, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("Expected an include cycle error, got: %v", err)
+	}
+}
+
+func TestIncludeDuplicateTask(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+includes = { docker = "docker/tasks.toml" }
+
+[tasks."docker:build"]
+cmds = ["true"]
+`,
+		"docker/tasks.toml": `
+[tasks.build]
+cmds = ["true"]
+`,
+	})
+
+	_, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err == nil || !strings.Contains(err.Error(), "docker:build") {
+		t.Errorf("Expected an error for the duplicate task, got: %v", err)
+	}
+}
+
+func TestDecodeInclude(t *testing.T) {
+	tests := []struct {
+		name     string
+		toml     string
+		expected Include
+		err      string
+	}{
+		{"path", `inc = "docker/tasks.toml"`, Include{Path: "docker/tasks.toml"}, ""},
+		{"table", `inc = { path = "web/tasks.toml", dir = "web" }`, Include{Path: "web/tasks.toml", Dir: "web"}, ""},
+		{"missing path", `inc = { dir = "web" }`, Include{}, "require a path"},
+		{"unknown option", `inc = { path = "a.toml", optional = true }`, Include{}, "unknown include option"},
+		{"invalid type", `inc = 1`, Include{}, "must be a path"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var v struct{ Inc Include }
+			_, err := toml.Decode(test.toml, &v)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected an error containing %q, got: %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if v.Inc != test.expected {
+				t.Errorf("expected %+v, got %+v", test.expected, v.Inc)
+			}
+		})
+	}
+}
+
+func TestDecodeIncludes(t *testing.T) {
+	var config Config
+	if _, err := toml.Decode(`includes = ["services/*/tasks.toml", "tools/tasks.toml"]`, &config); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	for _, path := range []string{"services/*/tasks.toml", "tools/tasks.toml"} {
+		if inc := config.Includes[path]; inc.Path != path || !inc.glob {
+			t.Errorf("Expected %s to be included by dir, got %+v", path, inc)
+		}
+	}
+
+	if _, err := toml.Decode(`includes = [1]`, &config); err == nil {
+		t.Errorf("Expected an error for an invalid include")
+	}
+}
+
+func TestGlobIncludes(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+includes = ["services/*/tasks.toml"]
+
+[tasks.test]
+cmds = ["echo root"]
+`,
+		"services/api/tasks.toml": `
+[tasks.test]
+cmds = ["echo api in $(basename $PWD)"]
+`,
+		"services/web/tasks.toml": `
+[tasks.test]
+cmds = ["exit 3"]
+`,
+		"services/db/tasks.toml": `
+[tasks.build]
+cmds = ["echo db"]
+`,
+	})
+
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	for _, test := range []struct {
+		name  string
+		task  string
+		all   bool
+		tasks []string
+	}{
+		{"glob", "services/*:test", false, []string{"services/api:test", "services/web:test"}},
+		{"all", "test", true, []string{"services/api:test", "services/web:test"}},
+		{"no match", "services/*:lint", false, nil},
+		{"plain", "test", false, []string{"test"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			exec := &Executor{Config: config, All: test.all}
+			if got := exec.MatchTasks(test.task); !slices.Equal(got, test.tasks) {
+				t.Errorf("Expected %v, got %v", test.tasks, got)
+			}
+		})
+	}
+
+	out, summary := &bytes.Buffer{}, &bytes.Buffer{}
+	exec := &Executor{Config: config, Stdout: out, Stderr: summary, Jobs: 1}
+	err = exec.RunTasks(config, &[]string{"services/*:test"})
+
+	var failed *FailedTasksError
+	if !errors.As(err, &failed) || len(failed.Errs) != 1 || !strings.Contains(err.Error(), "services/web:test") {
+		t.Errorf("Expected services/web:test to fail, got: %v", err)
+	}
+	if out.String() != "api in api\n" {
+		t.Errorf("Expected every matching task to run, got %q", out.String())
+	}
+	for _, line := range []string{"ok      services/api:test", "failed  services/web:test", "exit status 3"} {
+		if !strings.Contains(summary.String(), line) {
+			t.Errorf("Expected the summary to contain %q, got:\n%s", line, summary.String())
+		}
+	}
+}
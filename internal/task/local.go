@@ -0,0 +1,109 @@
+package task
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// the taskfile path that reads a taskfile from stdin
+const stdinTaskFile = "-"
+
+// the path of a taskfile's local override, e.g. tasks.local.toml next to
+// tasks.toml. it's meant to be gitignored and holds personal tweaks to the
+// shared taskfile
+func localTaskFile(taskFile string) string {
+	ext := filepath.Ext(taskFile)
+	return strings.TrimSuffix(taskFile, ext) + ".local" + ext
+}
+
+// the taskfiles to merge, in order: each of taskFiles followed by its local
+// override when there is one
+func taskFileLayers(taskFiles []string) []string {
+	var layers []string
+	for _, taskFile := range taskFiles {
+		layers = append(layers, taskFile)
+		if taskFile == stdinTaskFile {
+			continue
+		}
+		if local := localTaskFile(taskFile); fileExists(local) {
+			layers = append(layers, local)
+		}
+	}
+	return layers
+}
+
+// decodes taskFiles into config, merged in order along with their local
+// overrides. tables are merged key by key, so a later file can change a single
+// field of a task or add a single env var, while any other value, including a
+// list, replaces the earlier one. returns the files merged over the first
+func decodeTaskFiles(taskFiles []string, config *Config) ([]string, error) {
+	layers := taskFileLayers(taskFiles)
+	if len(layers) == 1 {
+		content, err := readTaskFile(layers[0])
+		if err != nil {
+			return nil, err
+		}
+		_, err = toml.Decode(string(content), config)
+		return nil, err
+	}
+
+	var merged map[string]any
+	for _, layer := range layers {
+		content, err := readTaskFile(layer)
+		if err != nil {
+			return nil, err
+		}
+		var table map[string]any
+		if _, err := toml.Decode(string(content), &table); err != nil {
+			return nil, fmt.Errorf("%s: %w", layer, err)
+		}
+		merged = mergeTables(merged, table)
+	}
+
+	var buf bytes.Buffer
+	if err := toml.NewEncoder(&buf).Encode(merged); err != nil {
+		return nil, err
+	}
+	if _, err := toml.Decode(buf.String(), config); err != nil {
+		return nil, fmt.Errorf("%s: %w", strings.Join(layers, " merged with "), err)
+	}
+	return layers[1:], nil
+}
+
+// the contents of a taskfile, read from stdin for -
+func readTaskFile(taskFile string) ([]byte, error) {
+	if taskFile == stdinTaskFile {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(taskFile)
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// merges override into base. tables are merged recursively, anything else in
+// override replaces the value in base
+func mergeTables(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base))
+	for k, v := range base {
+		merged[k] = v
+	}
+	for k, v := range override {
+		baseTable, baseOk := merged[k].(map[string]any)
+		overrideTable, overrideOk := v.(map[string]any)
+		if baseOk && overrideOk {
+			merged[k] = mergeTables(baseTable, overrideTable)
+		} else {
+			merged[k] = v
+		}
+	}
+	return merged
+}
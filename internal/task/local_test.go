@@ -0,0 +1,178 @@
+package task
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestMergeTables(t *testing.T) {
+	base := map[string]any{
+		"env": map[string]any{"A": "shared", "B": "shared"},
+		"tasks": map[string]any{
+			"build": map[string]any{"cmds": []any{"make"}, "deps": []any{[]any{"prep"}}},
+		},
+		"secrets": []any{"TOKEN"},
+	}
+	override := map[string]any{
+		"env": map[string]any{"B": "local"},
+		"tasks": map[string]any{
+			"build": map[string]any{"cmds": []any{"make -j8"}},
+			"mine":  map[string]any{"cmds": []any{"echo mine"}},
+		},
+		"secrets": []any{},
+	}
+
+	expected := map[string]any{
+		"env": map[string]any{"A": "shared", "B": "local"},
+		"tasks": map[string]any{
+			"build": map[string]any{"cmds": []any{"make -j8"}, "deps": []any{[]any{"prep"}}},
+			"mine":  map[string]any{"cmds": []any{"echo mine"}},
+		},
+		"secrets": []any{},
+	}
+	if got := mergeTables(base, override); !reflect.DeepEqual(got, expected) {
+		t.Errorf("expected %v, got %v", expected, got)
+	}
+	if base["env"].(map[string]any)["B"] != "shared" {
+		t.Errorf("expected the base tables to be left as-is")
+	}
+}
+
+func TestLocalTaskFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+env = { A = "shared", B = "shared" }
+
+[tasks.build]
+desc = "build it"
+deps = [["prep"]]
+cmds = ["make"]
+dotenv = ".env"
+
+[tasks.prep]
+cmds = ["echo prep"]
+`,
+		"tasks.local.toml": `
+env = { B = "local" }
+
+[tasks.build]
+cmds = ["make -j8"]
+dotenv = { path = ".env.local", required = true }
+
+[tasks.mine]
+cmds = ["echo mine"]
+`,
+	})
+
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if !slices.Equal(config.Overlays, []string{filepath.Join(dir, "tasks.local.toml")}) {
+		t.Errorf("Expected the local taskfile to be recorded, got %v", config.Overlays)
+	}
+	if config.Env["A"].Value != "shared" || config.Env["B"].Value != "local" {
+		t.Errorf("Expected the env tables to be merged, got %v", config.Env)
+	}
+
+	build := config.Tasks["build"]
+	if build.Desc != "build it" || len(build.Deps) != 1 {
+		t.Errorf("Expected fields the local taskfile doesn't set to be kept, got %+v", build)
+	}
+	if !slices.Equal(build.Cmds, []string{"make -j8"}) {
+		t.Errorf("Expected cmds to be replaced, got %v", build.Cmds)
+	}
+	if len(build.DotEnv) != 1 || build.DotEnv[0].Path != ".env.local" || !build.DotEnv[0].Required {
+		t.Errorf("Expected dotenv to be replaced, got %v", build.DotEnv)
+	}
+	if _, ok := config.Tasks["mine"]; !ok {
+		t.Errorf("Expected the local taskfile to add tasks")
+	}
+}
+
+func TestNoLocalTaskFile(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{"tasks.toml": "[tasks.build]\ncmds = [\"make\"]\n"})
+
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if len(config.Overlays) > 0 {
+		t.Errorf("Expected no local taskfile, got %v", config.Overlays)
+	}
+}
+
+func TestMultipleTaskFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": `
+[tasks.build]
+cmds = ["make"]
+env = { MODE = "dev", CACHE = "on" }
+`,
+		"tasks.local.toml": `
+[tasks.build.env]
+CACHE = "off"
+`,
+		"ci.toml": `
+[tasks.build.env]
+MODE = "ci"
+
+[tasks.publish]
+cmds = ["echo publish"]
+`,
+	})
+
+	base, ci := filepath.Join(dir, "tasks.toml"), filepath.Join(dir, "ci.toml")
+	config, err := loadTaskFiles([]string{base, ci}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	if config.TaskFilePath != base {
+		t.Errorf("Expected the first taskfile to be the base, got %q", config.TaskFilePath)
+	}
+	expected := []string{filepath.Join(dir, "tasks.local.toml"), ci}
+	if !slices.Equal(config.Overlays, expected) {
+		t.Errorf("Expected overlays %v, got %v", expected, config.Overlays)
+	}
+
+	env := config.Tasks["build"].Env
+	if env["MODE"].Value != "ci" || env["CACHE"].Value != "off" {
+		t.Errorf("Expected every taskfile to be merged in order, got %v", env)
+	}
+	if _, ok := config.Tasks["publish"]; !ok {
+		t.Errorf("Expected tasks from every taskfile")
+	}
+}
+
+func TestTaskFileFromStdin(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml": "[tasks.build]\ncmds = [\"make\"]\n",
+		"stdin.toml": "[tasks.build]\ncmds = [\"make generated\"]\n",
+	})
+
+	stdin, err := os.Open(filepath.Join(dir, "stdin.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdin.Close()
+	orig := os.Stdin
+	os.Stdin = stdin
+	defer func() { os.Stdin = orig }()
+
+	config, err := loadTaskFiles([]string{filepath.Join(dir, "tasks.toml"), "-"}, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	if !slices.Equal(config.Tasks["build"].Cmds, []string{"make generated"}) {
+		t.Errorf("Expected the taskfile from stdin to be merged, got %v", config.Tasks["build"].Cmds)
+	}
+}
@@ -0,0 +1,88 @@
+package task
+
+import (
+	"bytes"
+	"io"
+	"sort"
+	"sync"
+)
+
+// what secret values are replaced with
+const secretMask = "***"
+
+// replaces secret values written to w with secretMask. a write ending partway
+// through what could be a secret is held back until the next write, or Flush,
+// shows whether it is one
+type maskWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	secrets [][]byte
+	pending []byte
+}
+
+func newMaskWriter(w io.Writer, secrets []string) *maskWriter {
+	if w == nil {
+		w = io.Discard
+	}
+
+	mw := &maskWriter{w: w}
+	for _, s := range secrets {
+		if s != "" {
+			mw.secrets = append(mw.secrets, []byte(s))
+		}
+	}
+
+	// mask the longest secret first when one contains another
+	sort.Slice(mw.secrets, func(i, j int) bool {
+		return len(mw.secrets[i]) > len(mw.secrets[j])
+	})
+	return mw
+}
+
+func (mw *maskWriter) Write(p []byte) (int, error) {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	buf := mw.mask(append(mw.pending, p...))
+	keep := mw.partialSecret(buf)
+	mw.pending = append([]byte(nil), buf[len(buf)-keep:]...)
+
+	if _, err := mw.w.Write(buf[:len(buf)-keep]); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writes anything held back
+func (mw *maskWriter) Flush() error {
+	mw.mu.Lock()
+	defer mw.mu.Unlock()
+
+	if len(mw.pending) == 0 {
+		return nil
+	}
+	_, err := mw.w.Write(mw.pending)
+	mw.pending = nil
+	return err
+}
+
+func (mw *maskWriter) mask(buf []byte) []byte {
+	for _, secret := range mw.secrets {
+		buf = bytes.ReplaceAll(buf, secret, []byte(secretMask))
+	}
+	return buf
+}
+
+// the length of the longest suffix of buf that is the start of a secret
+func (mw *maskWriter) partialSecret(buf []byte) int {
+	longest := 0
+	for _, secret := range mw.secrets {
+		for n := min(len(secret)-1, len(buf)); n > longest; n-- {
+			if bytes.HasSuffix(buf, secret[:n]) {
+				longest = n
+				break
+			}
+		}
+	}
+	return longest
+}
@@ -0,0 +1,111 @@
+package task
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+)
+
+func TestMaskWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		secrets  []string
+		writes   []string
+		expected string
+	}{
+		{
+			name:     "single write",
+			secrets:  []string{"hunter2"},
+			writes:   []string{"password: hunter2\n"},
+			expected: "password: ***\n",
+		},
+		{
+			name:     "secret split across writes",
+			secrets:  []string{"hunter2"},
+			writes:   []string{"password: hun", "ter2\n"},
+			expected: "password: ***\n",
+		},
+		{
+			name:     "partial match that isn't a secret",
+			secrets:  []string{"hunter2"},
+			writes:   []string{"hunt", "ing\n"},
+			expected: "hunting\n",
+		},
+		{
+			name:     "held back until flush",
+			secrets:  []string{"hunter2"},
+			writes:   []string{"a hunter"},
+			expected: "a hunter",
+		},
+		{
+			name:     "longest secret first",
+			secrets:  []string{"abc", "abcdef"},
+			writes:   []string{"abcdef abc\n"},
+			expected: "*** ***\n",
+		},
+		{
+			name:     "empty secrets are ignored",
+			secrets:  []string{""},
+			writes:   []string{"nothing to hide\n"},
+			expected: "nothing to hide\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var out bytes.Buffer
+			mw := newMaskWriter(&out, test.secrets)
+			for _, w := range test.writes {
+				if n, err := mw.Write([]byte(w)); err != nil || n != len(w) {
+					t.Fatalf("expected to write %d bytes, wrote %d: %v", len(w), n, err)
+				}
+			}
+			mw.Flush()
+
+			if out.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
+
+func TestSecretsAreMaskedInTaskOutput(t *testing.T) {
+	dotEnvPath := createTempDotEnv(t, "API_KEY=s3cr3t-key\n")
+	defer removeFile(t, dotEnvPath)
+
+	var stdout, stderr bytes.Buffer
+	exec := Executor{
+		Stdout: &stdout,
+		Stderr: &stderr,
+		Config: &Config{
+			Env:     map[string]EnvValue{"NPM_TOKEN": {Value: "npm-t0ken"}},
+			Secrets: []string{"NPM_TOKEN"},
+			Tasks: map[string]Task{
+				"deploy": {
+					Cmds: []string{
+						`echo "curl -H $NPM_TOKEN"`,
+						`echo "key: $API_KEY" >&2`,
+						`echo "$OTHER"`,
+						`echo "db: $DB_PASS"`,
+					},
+					Dir:     filepath.Dir(dotEnvPath),
+					DotEnv:  DotEnvFiles{{Path: filepath.Base(dotEnvPath), Secret: true}},
+					Env:     map[string]EnvValue{"OTHER": {Value: "visible"}, "DB_PASS": {Value: "pa55"}},
+					Secrets: []string{"DB_PASS"},
+				},
+			},
+		},
+	}
+
+	if err := exec.RunTasks(exec.Config, &[]string{"deploy"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	expectedStdout := "curl -H ***\nvisible\ndb: ***\n"
+	if stdout.String() != expectedStdout {
+		t.Errorf("expected stdout %q, got %q", expectedStdout, stdout.String())
+	}
+	if stderr.String() != "key: ***\n" {
+		t.Errorf("expected stderr %q, got %q", "key: ***\n", stderr.String())
+	}
+}
@@ -0,0 +1,83 @@
+package task
+
+import (
+	"fmt"
+	"io"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// runs each task with the given params, at most Jobs at a time, then prints a
+// summary of every task's result. a failure doesn't stop the other tasks
+func (exec *Executor) runParallel(config *Config, tasks []string, given map[string]string) error {
+	results := runEach(exec.Jobs, tasks, func(i int) error {
+		return exec.runTask(config, tasks[i], given)
+	})
+	printSummary(exec.Stderr, results)
+	return failures(results)
+}
+
+// calls fn with the index of each of names, at most jobs at a time, defaulting
+// to the number of CPUs. results are in the same order as names
+func runEach(jobs int, names []string, fn func(i int) error) []Result {
+	if jobs < 1 {
+		jobs = runtime.NumCPU()
+	}
+
+	results := make([]Result, len(names))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	wg.Add(len(names))
+	for i, name := range names {
+		go func(i int, name string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			start := time.Now()
+			err := fn(i)
+			results[i] = Result{Task: name, Start: start, End: time.Now(), Err: err}
+		}(i, name)
+	}
+	wg.Wait()
+	return results
+}
+
+// the failed results, or nil if none failed
+func failures(results []Result) error {
+	var errs []error
+	for _, result := range results {
+		if result.Err != nil {
+			errs = append(errs, result.Err)
+		}
+	}
+	if len(errs) > 0 {
+		return &FailedTasksError{Errs: errs}
+	}
+	return nil
+}
+
+// prints a line for each result, e.g.
+//
+//	ok      services/api:test  1.2s
+//	failed  services/web:test  0.4s  exit status 1
+func printSummary(w io.Writer, results []Result) {
+	if w == nil {
+		return
+	}
+
+	width := 0
+	for _, result := range results {
+		width = max(width, len(result.Task))
+	}
+
+	fmt.Fprintln(w, "\nsummary:")
+	for _, result := range results {
+		status, reason := "ok", ""
+		if result.Err != nil {
+			status, reason = "failed", "  "+result.Err.Error()
+		}
+		fmt.Fprintf(w, "  %-6s  %-*s  %s%s\n", status, width, result.Task, result.End.Sub(result.Start).Round(time.Millisecond), reason)
+	}
+}
@@ -0,0 +1,316 @@
+package task
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// a parameter a task accepts, passed as `tsk deploy env=prod` or
+// `tsk deploy --env prod`
+type Param struct {
+	Desc     string   `toml:"desc"`
+	Required bool     `toml:"required"`
+	Default  string   `toml:"default"`
+	Choices  []string `toml:"choices"`
+	// one of string (the default), int or bool
+	Type string `toml:"type"`
+}
+
+// the param types and the values they accept, normalized
+var paramTypes = map[string]func(string) (string, error){
+	"string": func(v string) (string, error) { return v, nil },
+	"int": func(v string) (string, error) {
+		n, err := strconv.Atoi(v)
+		if err != nil {
+			return "", fmt.Errorf("%q is not an int", v)
+		}
+		return strconv.Itoa(n), nil
+	},
+	"bool": func(v string) (string, error) {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return "", fmt.Errorf("%q is not a bool", v)
+		}
+		return strconv.FormatBool(b), nil
+	},
+}
+
+// validates value against the param, returning it normalized
+func (p Param) validate(value string) (string, error) {
+	typ := p.Type
+	if typ == "" {
+		typ = "string"
+	}
+	value, err := paramTypes[typ](value)
+	if err != nil {
+		return "", err
+	}
+
+	if len(p.Choices) > 0 && !slices.Contains(p.Choices, value) {
+		return "", fmt.Errorf("%q is not one of %s", value, strings.Join(p.Choices, ", "))
+	}
+	return value, nil
+}
+
+// the param's value given on the command line, or its default. a missing
+// required param is an error
+func (p Param) resolve(task, name string, given map[string]string) (string, bool, error) {
+	value, ok := given[name]
+	if !ok {
+		if p.Default != "" {
+			value, ok = p.Default, true
+		} else if p.Required {
+			return "", false, fmt.Errorf("task '%s' requires param '%s'", task, name)
+		}
+	}
+	if !ok {
+		return "", false, nil
+	}
+
+	value, err := p.validate(value)
+	if err != nil {
+		return "", false, fmt.Errorf("invalid value for param '%s' of task '%s': %w", name, task, err)
+	}
+	return value, true, nil
+}
+
+// resolves every param of a task, leaving out optional params without a value
+func (t Task) resolveParams(task string, given map[string]string) (map[string]string, error) {
+	params := make(map[string]string, len(t.Params))
+	for _, name := range sortedParamNames(t.Params) {
+		value, ok, err := t.Params[name].resolve(task, name, given)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			params[name] = value
+		}
+	}
+	return params, nil
+}
+
+// verifies the params given for each task, and for the deps they're passed on
+// to, before anything runs. when Prompt is set, missing required params are
+// read from Stdin and added to Params
+func (exec *Executor) VerifyParams(tasks []string) error {
+	if exec.Params == nil {
+		exec.Params = make(map[string]map[string]string)
+	}
+
+	for _, root := range tasks {
+		given := exec.Params[root]
+		if given == nil {
+			given = make(map[string]string)
+			exec.Params[root] = given
+		}
+
+		// every task that runs as part of root, which all see its params
+		tree := exec.taskTree(root)
+
+		for name := range given {
+			declared := false
+			for _, task := range tree {
+				if _, ok := exec.Config.Tasks[task].Params[name]; ok {
+					declared = true
+					break
+				}
+			}
+			if !declared {
+				return fmt.Errorf("task '%s' has no param '%s'", root, name)
+			}
+		}
+
+		for _, task := range tree {
+			t := exec.Config.Tasks[task]
+			for _, name := range sortedParamNames(t.Params) {
+				p := t.Params[name]
+				if _, ok := given[name]; !ok && p.Required && p.Default == "" && exec.Prompt {
+					value, err := exec.promptParam(task, name, p)
+					if err != nil {
+						return err
+					}
+					given[name] = value
+				}
+			}
+			if _, err := t.resolveParams(task, given); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// reads a param's value from Stdin, asking again until it's valid
+func (exec *Executor) promptParam(task, name string, p Param) (string, error) {
+	prompt := fmt.Sprintf("%s: %s", task, name)
+	if p.Desc != "" {
+		prompt += fmt.Sprintf(" (%s)", p.Desc)
+	}
+	if len(p.Choices) > 0 {
+		prompt += fmt.Sprintf(" [%s]", strings.Join(p.Choices, ", "))
+	}
+
+	scanner := bufio.NewScanner(exec.Stdin)
+	for {
+		fmt.Fprintf(exec.Stderr, "%s: ", prompt)
+		if !scanner.Scan() {
+			return "", fmt.Errorf("task '%s' requires param '%s'", task, name)
+		}
+
+		value := strings.TrimSpace(scanner.Text())
+		if _, err := p.validate(value); err != nil {
+			fmt.Fprintln(exec.Stderr, err)
+			continue
+		}
+		return value, nil
+	}
+}
+
+// the task, or every task a glob matches, and all of their deps, each listed
+// once
+func (exec *Executor) taskTree(task string) []string {
+	var tree []string
+	seen := make(map[string]bool)
+	var walk func(name string)
+	walk = func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		tree = append(tree, name)
+		for _, depGroup := range exec.Config.Tasks[name].Deps {
+			for _, dep := range depGroup {
+				walk(dep)
+			}
+		}
+	}
+	for _, match := range exec.MatchTasks(task) {
+		walk(match)
+	}
+	return tree
+}
+
+// the env vars a param can't be exported as, since replacing them would break
+// the task's shell
+var reservedParamEnv = []string{"HOME", "PATH", "PWD", "SHELL", "USER"}
+
+// verifies no param of the taskfile's tasks is exported as a reserved env var
+func (c *Config) verifyParamNames() error {
+	for _, task := range *alphabetizeTaskList(&c.Tasks) {
+		for _, name := range sortedParamNames(c.Tasks[task].Params) {
+			if env := paramEnvName(name); slices.Contains(reservedParamEnv, env) {
+				return fmt.Errorf("param '%s' of task '%s' would replace $%s, rename it", name, task, env)
+			}
+		}
+	}
+	return nil
+}
+
+// params as env vars, named by paramEnvName
+func paramEnvVars(params map[string]string, source string) []EnvVar {
+	env := make(map[string]string, len(params))
+	for name, value := range params {
+		env[paramEnvName(name)] = value
+	}
+	return envVarsFromMap(env, source)
+}
+
+// the env var a param is exported as, its name in upper case with dashes
+// replaced by underscores
+func paramEnvName(name string) string {
+	return strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// the param as shown by --list, e.g. `env (required, one of: staging, prod)`
+func (p Param) describe(name string) string {
+	var details []string
+	if p.Required {
+		details = append(details, "required")
+	}
+	if p.Type != "" && p.Type != "string" {
+		details = append(details, p.Type)
+	}
+	if p.Default != "" {
+		details = append(details, "default: "+p.Default)
+	}
+	if len(p.Choices) > 0 {
+		details = append(details, "one of: "+strings.Join(p.Choices, ", "))
+	}
+
+	s := name
+	if len(details) > 0 {
+		s += fmt.Sprintf(" (%s)", strings.Join(details, ", "))
+	}
+	if p.Desc != "" {
+		s += " - " + p.Desc
+	}
+	return s
+}
+
+func sortedParamNames(params map[string]Param) []string {
+	names := make([]string, 0, len(params))
+	for name := range params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// reports whether stdin is a terminal a param can be prompted for on
+func StdinIsTerminal() bool {
+	return term.IsTerminal(int(os.Stdin.Fd()))
+}
+
+func (p *Param) UnmarshalTOML(data any) error {
+	table, ok := data.(map[string]any)
+	if !ok {
+		return fmt.Errorf("params must be tables, got %T", data)
+	}
+
+	for key, value := range table {
+		var ok bool
+		switch key {
+		case "desc":
+			p.Desc, ok = value.(string)
+		case "required":
+			p.Required, ok = value.(bool)
+		case "default":
+			// allow `default = 2` as well as `default = "2"`
+			switch value.(type) {
+			case string, int64, float64, bool:
+				p.Default, ok = fmt.Sprint(value), true
+			}
+		case "choices":
+			var list []any
+			if list, ok = value.([]any); ok {
+				for _, choice := range list {
+					p.Choices = append(p.Choices, fmt.Sprint(choice))
+				}
+			}
+		case "type":
+			p.Type, ok = value.(string)
+			if ok && paramTypes[p.Type] == nil {
+				return fmt.Errorf("unknown param type %q, expected one of string, int or bool", p.Type)
+			}
+		default:
+			return fmt.Errorf("unknown param option %q", key)
+		}
+		if !ok {
+			return fmt.Errorf("invalid value for param option %q: %v", key, value)
+		}
+	}
+
+	if p.Default != "" {
+		if _, err := p.validate(p.Default); err != nil {
+			return fmt.Errorf("invalid default: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func deployParams() map[string]Param {
+	return map[string]Param{
+		"env":      {Required: true, Choices: []string{"staging", "prod"}},
+		"replicas": {Default: "2", Type: "int"},
+		"dry-run":  {Type: "bool"},
+	}
+}
+
+func TestResolveParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		given    map[string]string
+		expected map[string]string
+		err      string
+	}{
+		{
+			name:     "defaults",
+			given:    map[string]string{"env": "prod"},
+			expected: map[string]string{"env": "prod", "replicas": "2"},
+		},
+		{
+			name:     "given values are normalized",
+			given:    map[string]string{"env": "staging", "replicas": "03", "dry-run": "1"},
+			expected: map[string]string{"env": "staging", "replicas": "3", "dry-run": "true"},
+		},
+		{
+			name:  "missing required param",
+			given: map[string]string{},
+			err:   "task 'deploy' requires param 'env'",
+		},
+		{
+			name:  "not one of the choices",
+			given: map[string]string{"env": "dev"},
+			err:   `"dev" is not one of staging, prod`,
+		},
+		{
+			name:  "wrong type",
+			given: map[string]string{"env": "prod", "replicas": "many"},
+			err:   `"many" is not an int`,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			task := Task{Params: deployParams()}
+			params, err := task.resolveParams("deploy", test.given)
+			if test.err != "" {
+				if err == nil || !strings.Contains(err.Error(), test.err) {
+					t.Errorf("expected an error containing %q, got %v", test.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+
+			if len(params) != len(test.expected) {
+				t.Errorf("expected %v, got %v", test.expected, params)
+			}
+			for name, value := range test.expected {
+				if params[name] != value {
+					t.Errorf("expected %s=%s, got %s=%s", name, value, name, params[name])
+				}
+			}
+		})
+	}
+}
+
+func TestParamsInCmdsAndEnv(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.toml")
+	os.WriteFile(path, []byte(`
+[tasks.build]
+cmds = ['echo "build {{.Params.env}} $ENV"']
+params = { env = { default = "dev" } }
+
+[tasks.deploy]
+deps = [["build"]]
+cmds = ['echo "deploy {{.Params.env}} $ENV $REPLICAS $DRY_RUN"']
+
+[tasks.deploy.params]
+env = { required = true, choices = ["staging", "prod"] }
+replicas = { default = 2, type = "int" }
+dry-run = { type = "bool" }
+`), 0644)
+
+	config, err := NewTaskConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: config,
+		Params: map[string]map[string]string{"deploy": {"env": "prod", "dry-run": "yes"}},
+	}
+
+	// "yes" isn't a bool
+	if err := exec.VerifyParams([]string{"deploy"}); err == nil {
+		t.Errorf("expected an error for an invalid bool")
+	}
+
+	exec.Params["deploy"]["dry-run"] = "true"
+	if err := exec.VerifyParams([]string{"deploy"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if err := exec.RunTasks(config, &[]string{"deploy"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	// the dep sees the params given to the task that depends on it
+	expected := "build prod prod\ndeploy prod prod 2 true\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+
+	// the config isn't changed by rendering
+	if !strings.Contains(config.Tasks["deploy"].Cmds[0], "{{.Params.env}}") {
+		t.Errorf("expected the task's cmds to be unchanged, got %v", config.Tasks["deploy"].Cmds)
+	}
+}
+
+func TestVerifyParams(t *testing.T) {
+	config := &Config{
+		Tasks: map[string]Task{
+			"deploy": {Params: deployParams()},
+			"lint":   {},
+		},
+	}
+
+	tests := []struct {
+		name   string
+		tasks  []string
+		params map[string]map[string]string
+		err    string
+	}{
+		{"unknown param", []string{"lint"}, map[string]map[string]string{"lint": {"env": "prod"}}, "task 'lint' has no param 'env'"},
+		{"missing required param", []string{"deploy"}, nil, "task 'deploy' requires param 'env'"},
+		{"valid", []string{"deploy", "lint"}, map[string]map[string]string{"deploy": {"env": "prod"}}, ""},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			exec := Executor{Config: config, Params: test.params}
+			err := exec.VerifyParams(test.tasks)
+			if test.err == "" && err != nil {
+				t.Errorf("expected no error, got: %v", err)
+			} else if test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Errorf("expected %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestPromptForParams(t *testing.T) {
+	stderr := new(bytes.Buffer)
+	exec := Executor{
+		Stdin:  strings.NewReader("dev\nprod\n"),
+		Stderr: stderr,
+		Config: &Config{Tasks: map[string]Task{"deploy": {Params: deployParams()}}},
+		Prompt: true,
+	}
+
+	if err := exec.VerifyParams([]string{"deploy"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if exec.Params["deploy"]["env"] != "prod" {
+		t.Errorf("expected env=prod, got %v", exec.Params["deploy"])
+	}
+
+	// the invalid answer is rejected and asked for again
+	expected := "deploy: env [staging, prod]: \"dev\" is not one of staging, prod\ndeploy: env [staging, prod]: "
+	if stderr.String() != expected {
+		t.Errorf("expected %q, got %q", expected, stderr.String())
+	}
+}
+
+func TestDecodeParamErrors(t *testing.T) {
+	for _, param := range []string{`{ type = "float" }`, `{ nope = true }`, `"prod"`, `{ default = "x", type = "int" }`} {
+		path := filepath.Join(t.TempDir(), "tasks.toml")
+		os.WriteFile(path, []byte("[tasks.deploy.params]\nenv = "+param), 0644)
+
+		if _, err := NewTaskConfig(path); err == nil {
+			t.Errorf("expected an error for env = %s, got nil", param)
+		}
+	}
+
+	// params can't replace the env vars the shell relies on
+	path := filepath.Join(t.TempDir(), "tasks.toml")
+	os.WriteFile(path, []byte("[tasks.deploy.params]\npath = {}\n"), 0644)
+	if _, err := NewTaskConfig(path); err == nil || !strings.Contains(err.Error(), "would replace $PATH") {
+		t.Errorf("expected an error for a param named path, got %v", err)
+	}
+}
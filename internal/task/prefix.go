@@ -0,0 +1,62 @@
+package task
+
+import (
+	"bytes"
+	"io"
+	"sync"
+)
+
+// prefixes each line written to w, e.g. with the project it came from. lines
+// are written whole while holding mu, so writers sharing w and mu don't
+// interleave their output mid-line. a line without its newline yet is held
+// back until the next write, or Flush
+type prefixWriter struct {
+	mu      *sync.Mutex
+	w       io.Writer
+	prefix  []byte
+	pending []byte
+}
+
+func newPrefixWriter(w io.Writer, mu *sync.Mutex, prefix string) *prefixWriter {
+	if w == nil {
+		w = io.Discard
+	}
+	return &prefixWriter{mu: mu, w: w, prefix: []byte(prefix)}
+}
+
+func (pw *prefixWriter) Write(p []byte) (int, error) {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	pw.pending = append(pw.pending, p...)
+	end := bytes.LastIndexByte(pw.pending, '\n')
+	if end < 0 {
+		return len(p), nil
+	}
+
+	var out []byte
+	for _, line := range bytes.SplitAfter(pw.pending[:end+1], []byte("\n")) {
+		if len(line) > 0 {
+			out = append(append(out, pw.prefix...), line...)
+		}
+	}
+	pw.pending = append([]byte(nil), pw.pending[end+1:]...)
+
+	if _, err := pw.w.Write(out); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// writes a line held back for want of a newline, ending it with one
+func (pw *prefixWriter) Flush() error {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+
+	if len(pw.pending) == 0 {
+		return nil
+	}
+	_, err := pw.w.Write(append(append(append([]byte(nil), pw.prefix...), pw.pending...), '\n'))
+	pw.pending = nil
+	return err
+}
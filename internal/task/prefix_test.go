@@ -0,0 +1,35 @@
+package task
+
+import (
+	"bytes"
+	"sync"
+	"testing"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		writes   []string
+		expected string
+	}{
+		{"line", []string{"hello\n"}, "[api] hello\n"},
+		{"lines in one write", []string{"one\ntwo\n"}, "[api] one\n[api] two\n"},
+		{"line split across writes", []string{"hel", "lo\nwor", "ld\n"}, "[api] hello\n[api] world\n"},
+		{"unterminated line on flush", []string{"partial"}, "[api] partial\n"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			pw := newPrefixWriter(out, &sync.Mutex{}, "[api] ")
+			for _, w := range test.writes {
+				pw.Write([]byte(w))
+			}
+			pw.Flush()
+
+			if out.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package task
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// a .gitignore and the dir it applies to
+type ignoreScope struct {
+	dir    string
+	ignore *gitignore
+}
+
+// the tasks.toml files in dir and every dir below it, the closest first. .git,
+// .tsk and anything ignored by a .gitignore in dir or the dirs between it and
+// the file are skipped. this is the downward counterpart of findTaskFile
+func FindTaskFiles(dir string) ([]string, error) {
+	var files []string
+	var walk func(dir string, scopes []ignoreScope) error
+	walk = func(dir string, scopes []ignoreScope) error {
+		ignore, err := readGitignore(dir)
+		if err != nil {
+			return err
+		}
+		scopes = append(slices.Clip(scopes), ignoreScope{dir: dir, ignore: ignore})
+
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		path := filepath.Join(dir, "tasks.toml")
+		if _, err := os.Stat(path); err == nil && !ignoredIn(scopes, path, false) {
+			files = append(files, path)
+		}
+
+		for _, entry := range entries {
+			path := filepath.Join(dir, entry.Name())
+			if !entry.IsDir() || alwaysIgnoredDirs[entry.Name()] || ignoredIn(scopes, path, true) {
+				continue
+			}
+			if err := walk(path, scopes); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walk(dir, nil); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// reports whether any of the .gitignores in scopes ignores path
+func ignoredIn(scopes []ignoreScope, path string, isDir bool) bool {
+	for _, scope := range scopes {
+		rel, err := filepath.Rel(scope.dir, path)
+		if err == nil && scope.ignore.ignored(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
+
+// runs tasks in each of configs that defines them, as a separate project with
+// its own taskfile's dir and env. projects run in parallel, at most Jobs at a
+// time, with each line of their output prefixed by the project's dir relative
+// to dir, followed by a summary of each project's result
+func (exec *Executor) RunRecursive(dir string, configs []*Config, tasks []string) error {
+	var names []string
+	var projects []*Executor
+	var projectTasks [][]string
+	for _, config := range configs {
+		var defined []string
+		for _, task := range tasks {
+			if t, ok := config.Tasks[task]; ok && !t.globalAlias && !t.Abstract {
+				defined = append(defined, task)
+			}
+		}
+		if len(defined) == 0 {
+			continue
+		}
+
+		name, err := filepath.Rel(dir, config.TaskFileDir)
+		if err != nil {
+			name = config.TaskFileDir
+		}
+
+		// verify every project before any of them run
+		project := *exec
+		project.Config = config
+		if err := project.VerifyTasks(defined); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		if err := project.VerifyParams(defined); err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+
+		names = append(names, name)
+		projects = append(projects, &project)
+		projectTasks = append(projectTasks, defined)
+	}
+	if len(projects) == 0 {
+		return fmt.Errorf("no taskfiles in %s define %s", dir, strings.Join(tasks, ", "))
+	}
+
+	var mu sync.Mutex
+	results := runEach(exec.Jobs, names, func(i int) error {
+		stdout := newPrefixWriter(exec.Stdout, &mu, "["+names[i]+"] ")
+		stderr := newPrefixWriter(exec.Stderr, &mu, "["+names[i]+"] ")
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		project := projects[i]
+		project.Stdout, project.Stderr = stdout, stderr
+		if err := project.RunTasks(project.Config, &projectTasks[i]); err != nil {
+			// failures are reported by project, as every project runs the same tasks
+			return &TaskError{Task: names[i], Err: flattenFailedTasks(err)}
+		}
+		return nil
+	})
+
+	printSummary(exec.Stderr, results)
+	return failures(results)
+}
+
+// the failures of a KeepGoing run on a single line, e.g. `test: exit status 1;
+// lint: exit status 2`, so they fit in the summary. the failures stay wrapped
+// so their exit codes are kept. any other error is returned as-is
+func flattenFailedTasks(err error) error {
+	var failed *FailedTasksError
+	if !errors.As(err, &failed) {
+		return err
+	}
+
+	var format []string
+	var args []any
+	for _, failure := range flattenErrors(failed.Errs) {
+		var taskErr *TaskError
+		if errors.As(failure, &taskErr) {
+			format = append(format, "%s: %w")
+			args = append(args, taskErr.Task, taskErr.Err)
+		} else {
+			format = append(format, "%w")
+			args = append(args, failure)
+		}
+	}
+	return fmt.Errorf(strings.Join(format, "; "), args...)
+}
@@ -0,0 +1,110 @@
+package task
+
+import (
+	"bytes"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFindTaskFiles(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml":                      "",
+		".gitignore":                      "node_modules/\n",
+		"api/tasks.toml":                  "",
+		"api/node_modules/dep/tasks.toml": "",
+		"web/.gitignore":                  "/build\n",
+		"web/tasks.toml":                  "",
+		"web/build/tasks.toml":            "",
+		"web/app/build/tasks.toml":        "",
+		".git/tasks.toml":                 "",
+		"no/taskfile/here.toml":           "",
+	})
+
+	files, err := FindTaskFiles(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	var got []string
+	for _, file := range files {
+		rel, _ := filepath.Rel(dir, file)
+		got = append(got, filepath.ToSlash(rel))
+	}
+	expected := []string{"tasks.toml", "api/tasks.toml", "web/tasks.toml", "web/app/build/tasks.toml"}
+	if !slices.Equal(got, expected) {
+		t.Errorf("Expected %v, got %v", expected, got)
+	}
+}
+
+func TestRunRecursive(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"api/tasks.toml": `
+env = { NAME = "api" }
+
+[tasks.test]
+cmds = ["echo testing $NAME in $(basename $PWD)"]
+`,
+		"web/tasks.toml": `
+[tasks.test]
+cmds = ["exit 3"]
+`,
+		"docs/tasks.toml": `
+[tasks.build]
+cmds = ["echo building docs"]
+`,
+	})
+
+	files, err := FindTaskFiles(dir)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+	var configs []*Config
+	for _, file := range files {
+		config, err := loadTaskFile(file, nil)
+		if err != nil {
+			t.Fatalf("Expected no error, got: %v", err)
+		}
+		configs = append(configs, config)
+	}
+
+	out, summary := &bytes.Buffer{}, &bytes.Buffer{}
+	exec := &Executor{Stdout: out, Stderr: summary}
+	err = exec.RunRecursive(dir, configs, []string{"test"})
+	if err == nil || !strings.Contains(err.Error(), "web: exit status 3") {
+		t.Errorf("Expected web to fail, got: %v", err)
+	}
+
+	if out.String() != "[api] testing api in api\n" {
+		t.Errorf("Expected each project's prefixed output, got %q", out.String())
+	}
+	for _, line := range []string{"ok      api", "failed  web"} {
+		if !strings.Contains(summary.String(), line) {
+			t.Errorf("Expected the summary to contain %q, got:\n%s", line, summary.String())
+		}
+	}
+	if strings.Contains(summary.String(), "docs") {
+		t.Errorf("Expected projects without the task to be skipped, got:\n%s", summary.String())
+	}
+
+	// with KeepGoing each project's failures are listed on its summary line
+	summary.Reset()
+	exec.KeepGoing = true
+	err = exec.RunRecursive(dir, configs, []string{"test"})
+	if err == nil || err.Error() != "failed tasks:\n  web: test: exit status 3" {
+		t.Errorf("Expected web's failed tasks, got: %v", err)
+	}
+	if ExitCode(err) != 3 {
+		t.Errorf("Expected the exit code of the failed task, got %d", ExitCode(err))
+	}
+	if !strings.Contains(summary.String(), "failed  web  ") || !strings.HasSuffix(summary.String(), "test: exit status 3\n") {
+		t.Errorf("Expected web's failure on one line, got:\n%s", summary.String())
+	}
+
+	if err := exec.RunRecursive(dir, configs, []string{"lint"}); err == nil {
+		t.Errorf("Expected an error when no project defines the task")
+	}
+}
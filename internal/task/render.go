@@ -0,0 +1,336 @@
+package task
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// the values a task's templates are rendered with
+type Vals struct {
+	// the args after --, each shell-quoted and joined with spaces
+	CLI_ARGS string
+	// the args after -- joined with spaces, as-is
+	CLI_ARGS_RAW string
+	// the args after --
+	Args []string
+	// the task's params
+	Params map[string]string
+	// the top-level vars, overridden by the task's own. unlike env they're only
+	// available to templates
+	Vars map[string]string
+
+	// the OS and architecture tsk is running on, as in GOOS and GOARCH
+	OS   string
+	ARCH string
+	// the directory of the taskfile
+	TaskFileDir string
+	// the directory tsk was run from
+	InvocationDir string
+	// the task being rendered, empty for top-level fields
+	TaskName string
+}
+
+// the values task is rendered with. params are the task's own
+func (exec *Executor) vals(config *Config, task string, params map[string]string) *Vals {
+	quoted := make([]string, len(exec.Args))
+	for i, arg := range exec.Args {
+		quoted[i] = shellQuote(arg)
+	}
+	wd, _ := os.Getwd()
+
+	return &Vals{
+		CLI_ARGS:      strings.Join(quoted, " "),
+		CLI_ARGS_RAW:  strings.Join(exec.Args, " "),
+		Args:          exec.Args,
+		Params:        params,
+		OS:            runtime.GOOS,
+		ARCH:          runtime.GOARCH,
+		TaskFileDir:   config.TaskFileDir,
+		InvocationDir: wd,
+		TaskName:      task,
+	}
+}
+
+// the functions available to templates
+func (exec *Executor) templateFuncs(config *Config) template.FuncMap {
+	return template.FuncMap{
+		// the value of a var in the env tsk was run with
+		"env": os.Getenv,
+		// value, or def when value is empty: {{.Params.x | default "y"}}
+		"default": func(def, value any) any {
+			if isEmpty(value) {
+				return def
+			}
+			return value
+		},
+		// value, or an error with msg when value is empty
+		"required": func(msg string, value any) (any, error) {
+			if isEmpty(value) {
+				return nil, errors.New(msg)
+			}
+			return value, nil
+		},
+		// the trimmed output of a command run in the taskfile's dir. like `sh`
+		// env values, each command runs once per run
+		"sh": func(cmd string) (string, error) {
+			return exec.shOutput(cmd, config.TaskFileDir, os.Environ())
+		},
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+		// replaces every old in s with new: {{.OS | replace "darwin" "macos"}}
+		"replace": func(old, new, s string) string {
+			return strings.ReplaceAll(s, old, new)
+		},
+		"joinPath": filepath.Join,
+		"fromJSON": func(s string) (any, error) {
+			var v any
+			err := json.Unmarshal([]byte(s), &v)
+			return v, err
+		},
+		"now": time.Now,
+	}
+}
+
+// reports whether v is nil or its type's zero value
+func isEmpty(v any) bool {
+	return v == nil || reflect.ValueOf(v).IsZero()
+}
+
+// a renderer for the fields of task, or the top-level fields when task is empty
+func (exec *Executor) renderer(config *Config, task string, params map[string]string) *renderer {
+	r := &renderer{
+		vals:  exec.vals(config, task, params),
+		funcs: exec.templateFuncs(config),
+		sh: func(cmd string) (string, error) {
+			return exec.shOutput(cmd, config.TaskFileDir, os.Environ())
+		},
+		left:  "{{",
+		right: "}}",
+	}
+	if len(config.TemplateDelims) == 2 {
+		r.left, r.right = config.TemplateDelims[0], config.TemplateDelims[1]
+	}
+	r.vars("vars", config.Vars)
+	if task != "" {
+		r.prefix = "tasks." + task
+	}
+	return r
+}
+
+// renders the fields of a taskfile that may contain templates. the first error
+// is kept and names the field that caused it
+type renderer struct {
+	vals   *Vals
+	funcs  template.FuncMap
+	prefix string
+	err    error
+	// runs the command of an `sh` var, returning its trimmed output
+	sh func(cmd string) (string, error)
+
+	// the template delimiters, {{ and }} unless template_delims is set
+	left, right string
+}
+
+// renders a single field, e.g. "cmds[0]"
+func (r *renderer) string(field, s string) string {
+	if r.err != nil || !strings.Contains(s, r.left) {
+		return s
+	}
+
+	name := r.name(field)
+
+	// a param that wasn't given renders as an empty string
+	tmpl, err := template.New(name).Delims(r.left, r.right).Funcs(r.funcs).Option("missingkey=zero").Parse(s)
+	if err != nil {
+		r.err = err
+		return s
+	}
+
+	var b strings.Builder
+	if err := tmpl.Execute(&b, r.vals); err != nil {
+		r.err = err
+		return s
+	}
+	return b.String()
+}
+
+// the full name of a field, e.g. tasks.build.cmds[0]
+func (r *renderer) name(field string) string {
+	if r.prefix == "" {
+		return field
+	}
+	return r.prefix + "." + field
+}
+
+func (r *renderer) strings(field string, list []string) []string {
+	if list == nil {
+		return nil
+	}
+	rendered := make([]string, len(list))
+	for i, s := range list {
+		rendered[i] = r.string(fmt.Sprintf("%s[%d]", field, i), s)
+	}
+	return rendered
+}
+
+func (r *renderer) env(field string, env map[string]EnvValue) map[string]EnvValue {
+	if env == nil {
+		return nil
+	}
+	rendered := make(map[string]EnvValue, len(env))
+	for name, v := range env {
+		rendered[name] = EnvValue{
+			Value: r.string(field+"."+name, v.Value),
+			Sh:    r.string(field+"."+name+".sh", v.Sh),
+		}
+	}
+	return rendered
+}
+
+// resolves vars and adds them to the vals, after any already there. vars are
+// rendered after the vars they refer to as .Vars.NAME, and a var referring to
+// its own name sees the value it overrides, e.g. a task's var extending a
+// top-level one
+func (r *renderer) vars(field string, vars map[string]EnvValue) {
+	if len(vars) == 0 || r.err != nil {
+		return
+	}
+
+	order, err := varOrder(vars)
+	if err != nil {
+		r.err = fmt.Errorf("%s: %w", r.name(field), err)
+		return
+	}
+
+	resolved := make(map[string]string, len(r.vals.Vars)+len(vars))
+	maps.Copy(resolved, r.vals.Vars)
+	r.vals.Vars = resolved
+	for _, name := range order {
+		v := vars[name]
+		value := r.string(field+"."+name, v.Value)
+		if v.Sh != "" {
+			cmd := r.string(field+"."+name+".sh", v.Sh)
+			if r.err != nil {
+				return
+			}
+			if value, err = r.sh(cmd); err != nil {
+				r.err = fmt.Errorf("%s: %w", r.name(field+"."+name+".sh"), err)
+				return
+			}
+		}
+		if r.err != nil {
+			return
+		}
+		resolved[name] = value
+	}
+}
+
+// a reference to a var in a template
+var varRef = regexp.MustCompile(`\.Vars\.(\w+)`)
+
+// the names of vars ordered so each comes after the vars it refers to
+func varOrder(vars map[string]EnvValue) ([]string, error) {
+	names := make([]string, 0, len(vars))
+	for name := range vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var order []string
+	done, visiting := make(map[string]bool), make(map[string]bool)
+	var visit func(name string, path []string) error
+	visit = func(name string, path []string) error {
+		if done[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("vars cycle: %s", strings.Join(append(path, name), " -> "))
+		}
+		visiting[name] = true
+
+		v := vars[name]
+		for _, match := range varRef.FindAllStringSubmatch(v.Value+" "+v.Sh, -1) {
+			ref := match[1]
+			if _, ok := vars[ref]; !ok || ref == name {
+				continue
+			}
+			if err := visit(ref, append(path, name)); err != nil {
+				return err
+			}
+		}
+
+		done[name] = true
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name, nil); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+func (r *renderer) dotEnv(field string, files DotEnvFiles) DotEnvFiles {
+	if files == nil {
+		return nil
+	}
+	rendered := make(DotEnvFiles, len(files))
+	for i, file := range files {
+		file.Path = r.string(fmt.Sprintf("%s[%d].path", field, i), file.Path)
+		file.Identity = r.string(fmt.Sprintf("%s[%d].identity", field, i), file.Identity)
+		rendered[i] = file
+	}
+	return rendered
+}
+
+// a task with its params resolved from those given and its templates rendered
+func (exec *Executor) renderTask(config *Config, name string, given map[string]string) (Task, map[string]string, error) {
+	params, err := config.Tasks[name].resolveParams(name, given)
+	if err != nil {
+		return Task{}, nil, err
+	}
+	t, err := config.Tasks[name].render(exec.renderer(config.fileOf(name), name, params))
+	if err != nil {
+		return Task{}, nil, err
+	}
+	return t, params, nil
+}
+
+// a copy of the task with its templates rendered. tasks with `template = false`
+// are left as-is
+func (t Task) render(r *renderer) (Task, error) {
+	if t.Template != nil && !*t.Template {
+		return t, nil
+	}
+
+	r.vars("vars", t.Vars)
+
+	t.Cmds = r.strings("cmds", t.Cmds)
+	t.Dir = r.string("dir", t.Dir)
+	t.Env = r.env("env", t.Env)
+	t.DotEnv = r.dotEnv("dotenv", t.DotEnv)
+	t.Watch = r.strings("watch", t.Watch)
+	return t, r.err
+}
+
+// a copy of the config with the templates in its top-level fields rendered.
+// tasks are rendered when they run, with their own params
+func (c *Config) render(r *renderer) (*Config, error) {
+	rendered := *c
+	rendered.Env = r.env("env", c.Env)
+	rendered.DotEnv = r.dotEnv("dotenv", c.DotEnv)
+	return &rendered, r.err
+}
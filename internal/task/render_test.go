@@ -0,0 +1,199 @@
+package task
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestTemplateFuncs(t *testing.T) {
+	t.Setenv("TSK_TEMPLATE_TEST", "from env")
+	dir := t.TempDir()
+	config := &Config{TaskFileDir: dir}
+	exec := &Executor{Config: config}
+
+	tests := []struct {
+		name     string
+		tmpl     string
+		params   map[string]string
+		expected string
+	}{
+		{"env", `{{env "TSK_TEMPLATE_TEST"}}`, nil, "from env"},
+		{"default with empty value", `{{.Params.x | default "fallback"}}`, nil, "fallback"},
+		{"default with value", `{{.Params.x | default "fallback"}}`, map[string]string{"x": "given"}, "given"},
+		{"required with value", `{{required "x is required" .Params.x}}`, map[string]string{"x": "given"}, "given"},
+		{"sh", `{{sh "pwd"}}`, nil, dir},
+		{"upper", `{{"abc" | upper}}`, nil, "ABC"},
+		{"lower", `{{"ABC" | lower}}`, nil, "abc"},
+		{"replace", `{{"darwin" | replace "darwin" "macos"}}`, nil, "macos"},
+		{"joinPath", `{{joinPath "a" "b" "c.txt"}}`, nil, filepath.Join("a", "b", "c.txt")},
+		{"fromJSON", `{{(fromJSON "{\"version\": \"1.2.3\"}").version}}`, nil, "1.2.3"},
+		{"now", `{{now.Year}}`, nil, "20"},
+		{"context", `{{.OS}}/{{.ARCH}} {{.TaskName}} {{.TaskFileDir}}`, nil, runtime.GOOS + "/" + runtime.GOARCH + " test " + dir},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := exec.renderer(config, "test", test.params)
+			got := r.string("cmds[0]", test.tmpl)
+			if r.err != nil {
+				t.Fatalf("expected no error, got: %v", r.err)
+			}
+			if !strings.HasPrefix(got, test.expected) {
+				t.Errorf("expected %q, got %q", test.expected, got)
+			}
+		})
+	}
+}
+
+func TestRequiredTemplateFunc(t *testing.T) {
+	config := &Config{}
+	r := (&Executor{Config: config}).renderer(config, "deploy", nil)
+	r.string("cmds[0]", `{{required "REGION must be set" (env "TSK_UNSET_VAR")}}`)
+
+	if r.err == nil || !strings.Contains(r.err.Error(), "REGION must be set") || !strings.Contains(r.err.Error(), "tasks.deploy.cmds[0]") {
+		t.Errorf("expected an error naming the field with the message, got: %v", r.err)
+	}
+}
+
+func TestInvocationDir(t *testing.T) {
+	wd, _ := os.Getwd()
+	config := &Config{}
+	r := (&Executor{Config: config}).renderer(config, "", nil)
+	if got := r.string("dir", "{{.InvocationDir}}"); got != wd {
+		t.Errorf("expected %s, got %s", wd, got)
+	}
+}
+
+// sh runs each command once per run, however many times it's used
+func TestShTemplateFuncIsMemoized(t *testing.T) {
+	dir := t.TempDir()
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: &Config{
+			TaskFileDir: dir,
+			Tasks: map[string]Task{
+				"count": {Cmds: []string{
+					`echo {{sh "echo x >> calls; wc -l < calls"}}`,
+					`echo {{sh "echo x >> calls; wc -l < calls"}}`,
+				}},
+			},
+		},
+	}
+
+	if err := exec.RunTasks(exec.Config, &[]string{"count"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if strings.Fields(out.String())[0] != "1" || strings.Fields(out.String())[1] != "1" {
+		t.Errorf("expected the command to run once, got %q", out.String())
+	}
+}
+
+func TestTemplateDelims(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Args:   []string{"arg"},
+		Config: &Config{
+			TemplateDelims: []string{"[[", "]]"},
+			Tasks: map[string]Task{
+				"docker": {Cmds: []string{"echo '{{.ID}}' [[.CLI_ARGS]]"}},
+			},
+		},
+	}
+
+	if err := exec.RunTasks(exec.Config, &[]string{"docker"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if out.String() != "{{.ID}} arg\n" {
+		t.Errorf("expected %q, got %q", "{{.ID}} arg\n", out.String())
+	}
+}
+
+func TestTemplateOptOut(t *testing.T) {
+	disabled := false
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: &Config{
+			Tasks: map[string]Task{
+				"helm": {Cmds: []string{"echo '{{ .Values.image }}'"}, Template: &disabled},
+			},
+		},
+	}
+
+	if err := exec.RunTasks(exec.Config, &[]string{"helm"}); err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if out.String() != "{{ .Values.image }}\n" {
+		t.Errorf("expected %q, got %q", "{{ .Values.image }}\n", out.String())
+	}
+}
+
+func TestInvalidTemplateDelims(t *testing.T) {
+	for _, delims := range []string{`["[["]`, `["[[", ""]`, `["<", ">", "!"]`} {
+		path := filepath.Join(t.TempDir(), "tasks.toml")
+		os.WriteFile(path, []byte("template_delims = "+delims), 0644)
+
+		if _, err := NewTaskConfig(path); err == nil {
+			t.Errorf("expected an error for template_delims = %s", delims)
+		}
+	}
+}
+
+func TestVars(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "tasks.toml")
+	os.WriteFile(path, []byte(`
+[vars]
+IMAGE = "{{.Vars.REGISTRY}}/app:{{.Vars.TAG}}"
+REGISTRY = "ghcr.io/acme"
+TAG = { sh = "echo v1" }
+
+[tasks.build]
+cmds = ["echo {{.Vars.IMAGE}}", "echo ${IMAGE:-unset} ${TAG:-unset}"]
+
+[tasks.dev]
+vars = { TAG = "{{.Vars.TAG}}-dev", NAME = "{{.Vars.TAG | upper}}" }
+cmds = ["echo {{.Vars.TAG}} {{.Vars.NAME}} {{.Vars.IMAGE}}"]
+
+[tasks.cycle]
+vars = { A = "{{.Vars.B}}", B = "{{.Vars.A}}" }
+cmds = ["echo never"]
+`), 0644)
+
+	config, err := NewTaskConfig(path)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		task     string
+		expected string
+	}{
+		{"build", "ghcr.io/acme/app:v1\nunset unset\n"},
+		{"dev", "v1-dev V1-DEV ghcr.io/acme/app:v1\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.task, func(t *testing.T) {
+			out := &bytes.Buffer{}
+			exec := &Executor{Config: config, Stdout: out}
+			if err := exec.RunTasks(config, &[]string{test.task}); err != nil {
+				t.Fatalf("expected no error, got: %v", err)
+			}
+			if out.String() != test.expected {
+				t.Errorf("expected %q, got %q", test.expected, out.String())
+			}
+		})
+	}
+
+	exec := &Executor{Config: config, Stdout: &bytes.Buffer{}}
+	err = exec.RunTasks(config, &[]string{"cycle"})
+	if err == nil || !strings.Contains(err.Error(), "tasks.cycle.vars: vars cycle") {
+		t.Errorf("expected a vars cycle error, got: %v", err)
+	}
+}
@@ -3,14 +3,18 @@ package task
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"slices"
 	"strings"
 	"sync"
+	"time"
 
 	output "github.com/notnmeyer/tsk/internal/outputformat"
 
@@ -22,24 +26,64 @@ import (
 
 // represents parsed task file
 type Config struct {
-	DotEnv       string            `toml:"dotenv"`
-	Env          map[string]string `toml:"env"`
-	Tasks        map[string]Task   `toml:"tasks"`
-	ScriptDir    string            `toml:"script_dir"`
-	TaskFileDir  string            `toml:"task_file_dir"`
-	TaskFilePath string            `toml:"task_file_path"`
+	DotEnv          DotEnvFiles         `toml:"dotenv"`
+	Env             map[string]EnvValue `toml:"env"`
+	Includes        Includes            `toml:"includes"`
+	PurePassthrough []string            `toml:"pure_passthrough"`
+	Tasks           map[string]Task     `toml:"tasks"`
+	ScriptDir       string              `toml:"script_dir"`
+	Secrets         []string            `toml:"secrets"`
+	Strict          bool                `toml:"strict"`
+	TemplateDelims  []string            `toml:"template_delims"`
+	Vars            map[string]EnvValue `toml:"vars"`
+	TaskFileDir     string              `toml:"task_file_dir"`
+	TaskFilePath    string              `toml:"task_file_path"`
+
+	// the taskfiles merged over TaskFilePath, in order: its local override and
+	// any other taskfiles given with -f along with their own overrides
+	Overlays []string `toml:"overlays"`
+
+	// the files of the taskfiles included by this one, and by those in turn
+	included []string
+}
+
+// every file the config was loaded from: the taskfile, the files merged over
+// it and the files of the taskfiles it includes
+func (c *Config) Files() []string {
+	return slices.Concat([]string{c.TaskFilePath}, c.Overlays, c.included)
 }
 
 // represents an individual task
 type Task struct {
-	Cmds        []string          `toml:"cmds"`
-	Deps        [][]string        `toml:"deps"`
-	Desc        string            `toml:"desc"`
-	Description string            `toml:"description"`
-	Dir         string            `toml:"dir"`
-	Env         map[string]string `toml:"env"`
-	DotEnv      string            `toml:"dotenv"`
-	Pure        bool              `toml:"pure"`
+	Abstract        bool                `toml:"abstract"`
+	Cmds            []string            `toml:"cmds"`
+	Deps            [][]string          `toml:"deps"`
+	Desc            string              `toml:"desc"`
+	Description     string              `toml:"description"`
+	Dir             string              `toml:"dir"`
+	Env             map[string]EnvValue `toml:"env"`
+	DotEnv          DotEnvFiles         `toml:"dotenv"`
+	Extends         Extends             `toml:"extends"`
+	Params          map[string]Param    `toml:"params"`
+	Pure            *bool               `toml:"pure"`
+	PurePassthrough []string            `toml:"pure_passthrough"`
+	Secrets         []string            `toml:"secrets"`
+	Template        *bool               `toml:"template"`
+	Vars            map[string]EnvValue `toml:"vars"`
+	Watch           []string            `toml:"watch"`
+
+	// the taskfile an included task was defined in and its name there
+	file      *Config
+	localName string
+
+	// the task is a global task available by its own name, as well as in the
+	// global namespace
+	globalAlias bool
+}
+
+// reports whether the task runs with a pure env, see compileEnv
+func (t Task) isPure() bool {
+	return t.Pure != nil && *t.Pure
 }
 
 type Executor struct {
@@ -47,162 +91,331 @@ type Executor struct {
 	Stdin  io.Reader
 	Stderr io.Writer
 	Config *Config
+
+	// called after each task's cmds finish. deps run in parallel so it may be
+	// called concurrently
+	OnResult func(Result)
+
+	// tasks that aren't run, e.g. because they already succeeded in a resumed run
+	Skip map[string]bool
+
+	// keep running tasks that don't depend on a failed task rather than
+	// stopping at the first failure
+	KeepGoing bool
+
+	// the params given for each task on the command line, keyed by task. they
+	// are passed on to the task's deps
+	Params map[string]map[string]string
+
+	// prompt for missing required params rather than failing
+	Prompt bool
+
+	// the args after --, set as the positional params ("$@") of every cmd
+	Args []string
+
+	// run each task in every included taskfile that defines it, as if it were
+	// given as the glob *:task
+	All bool
+
+	// how many tasks matched by a glob run at once, defaulting to the number
+	// of CPUs
+	Jobs int
+
+	// cancels running cmds, used by watch mode to restart tasks
+	ctx context.Context
+
+	// the output of `sh` env values, shared by every task in a run
+	sh *shCache
 }
 
-// sets the top-level env
-func (c *Config) CompileEnv() ([]string, error) {
-	env := ConvertEnvToStringSlice(c.Env)
+// the outcome of running a single task
+type Result struct {
+	Task  string
+	Start time.Time
+	End   time.Time
+	Err   error
+}
 
-	if c.DotEnv != "" {
-		var err error
-		env, err = appendDotEnvToEnv(env, filepath.Join(c.TaskFileDir, c.DotEnv))
-		if err != nil {
-			return nil, err
+// a cmd of Task failed
+type TaskError struct {
+	Task string
+	Err  error
+}
+
+func (e *TaskError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TaskError) Unwrap() error {
+	return e.Err
+}
+
+// every failure from a run with KeepGoing
+type FailedTasksError struct {
+	Errs []error
+}
+
+func (e *FailedTasksError) Error() string {
+	failures := flattenErrors(e.Errs)
+
+	var b strings.Builder
+	b.WriteString("failed tasks:")
+	for _, err := range failures {
+		var taskErr *TaskError
+		if errors.As(err, &taskErr) {
+			fmt.Fprintf(&b, "\n  %s: %s", taskErr.Task, taskErr.Err)
+		} else {
+			fmt.Fprintf(&b, "\n  %s", err)
 		}
 	}
+	return b.String()
+}
+
+func (e *FailedTasksError) Unwrap() []error {
+	return e.Errs
+}
 
-	return env, nil
+// unwraps joined errors into the individual failures, listing a task that
+// failed more than once (e.g. as the dep of several tasks) only once
+func flattenErrors(errs []error) []error {
+	var flat []error
+	seen := make(map[string]bool)
+	var walk func(err error)
+	walk = func(err error) {
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				walk(e)
+			}
+			return
+		}
+
+		var taskErr *TaskError
+		if errors.As(err, &taskErr) {
+			if seen[taskErr.Task] {
+				return
+			}
+			seen[taskErr.Task] = true
+		}
+		flat = append(flat, err)
+	}
+	for _, err := range errs {
+		walk(err)
+	}
+	return flat
 }
 
-func (t *Task) CompileEnv(env []string) ([]string, error) {
-	env = append(env, ConvertEnvToStringSlice(t.Env)...)
+// the exit code of a failed cmd, or 1 for any other error
+func ExitCode(err error) int {
+	if err == nil {
+		return 0
+	}
 
-	// a "pure" environment does not inherit the full parent env, but does inherit
-	// USER and HOME. otherwise it inherits the entire parent env.
-	if t.Pure {
-		env = append(
-			env,
-			fmt.Sprintf("USER=%s", os.Getenv("USER")),
-			fmt.Sprintf("HOME=%s", os.Getenv("HOME")),
-		)
-	} else {
-		env = append(env, os.Environ()...)
+	var status interp.ExitStatus
+	if errors.As(err, &status) {
+		return int(status)
 	}
+	return 1
+}
 
-	if t.DotEnv != "" {
+func (exec *Executor) RunTasks(config *Config, tasks *[]string) error {
+	// each run evaluates `sh` env values afresh
+	run := *exec
+	run.sh = newShCache()
+	return run.runTasks(config, tasks)
+}
+
+func (exec *Executor) runTasks(config *Config, tasks *[]string) error {
+	var errs []error
+	for _, task := range *tasks {
 		var err error
-		env, err = appendDotEnvToEnv(env, filepath.Join(t.Dir, t.DotEnv))
+		if exec.expands(task) {
+			// a glob runs every task it matches in parallel
+			err = exec.runParallel(config, exec.MatchTasks(task), exec.Params[task])
+		} else {
+			err = exec.runTask(config, task, exec.Params[task])
+		}
 		if err != nil {
-			return nil, err
+			// with KeepGoing, a failure only stops the tasks that depend on it
+			if !exec.KeepGoing {
+				return err
+			}
+			errs = append(errs, err)
 		}
 	}
 
-	return env, nil
+	if len(errs) > 0 {
+		return &FailedTasksError{Errs: errs}
+	}
+	return nil
 }
 
-func (exec *Executor) RunTasks(config *Config, tasks *[]string) error {
-	// top-level env
-	env, err := config.CompileEnv()
-	if err != nil {
+// runs a task's deps and then the task itself. each task compiles its own env
+// from the top-level env of its taskfile so one task's env never leaks into the
+// next. the params given to the task are passed on to its deps
+func (exec *Executor) runTask(config *Config, task string, given map[string]string) error {
+	// verify the task exists
+	if err := exec.verifyTasks([]string{task}); err != nil {
 		return err
 	}
+	if exec.Skip[task] {
+		return nil
+	}
 
-	for _, task := range *tasks {
-		// verify the task exists
-		if err := exec.VerifyTasks([]string{task}); err != nil {
-			return err
-		}
-		taskConfig := config.Tasks[task]
+	// params are validated and templates rendered before any deps run, so a
+	// broken task fails fast
+	taskConfig, params, err := exec.renderTask(config, task, given)
+	if err != nil {
+		return err
+	}
 
-		if taskConfig.Dir == "" {
-			taskConfig.Dir = config.TaskFileDir
-		}
+	file := config.fileOf(task)
+	if taskConfig.Dir == "" {
+		taskConfig.Dir = file.TaskFileDir
+	}
 
-		if len(taskConfig.Deps) > 0 {
-			for _, depGroup := range taskConfig.Deps {
-				var wg sync.WaitGroup
-				wg.Add(len(depGroup))
-				for _, dep := range depGroup {
-					// verify the dep exists
-					if err := exec.VerifyTasks([]string{dep}); err != nil {
-						return err
-					}
+	if len(taskConfig.Deps) > 0 {
+		for _, depGroup := range taskConfig.Deps {
+			var wg sync.WaitGroup
+			errs := make([]error, len(depGroup))
+			wg.Add(len(depGroup))
+			for i, dep := range depGroup {
+				go func(i int, dep string) {
+					defer wg.Done()
+					errs[i] = exec.runTask(config, dep, given)
+				}(i, dep)
+			}
+			wg.Wait()
 
-					go func(dep string) {
-						defer wg.Done()
-						exec.RunTasks(config, &[]string{dep})
-					}(dep)
-				}
-				wg.Wait()
+			// if a dep failed, don't run the remaining groups or the task itself
+			if err := errors.Join(errs...); err != nil {
+				return err
 			}
 		}
+	}
 
-		// add any task-specific env bits
-		env, err = taskConfig.CompileEnv(env)
-		if err != nil {
-			return err
-		}
+	topLevelEnv, err := exec.topLevelEnv(file)
+	if err != nil {
+		return err
+	}
 
-		// if a task contains cmds, run them
-		if len(taskConfig.Cmds) > 0 {
-			for _, cmd := range taskConfig.Cmds {
-				err := exec.runCommand(cmd, taskConfig.Dir, env)
-				if err != nil {
-					fmt.Println(err.Error())
-					// if the cmd exited with an error, bail immediately
-					os.Exit(1)
-				}
-			}
-		} else {
-			// if there are no cmds then we intend to run a script with the name name as the task
-			script := fmt.Sprintf("%s/%s", exec.Config.ScriptDir, task)
-			err := exec.runCommand(script, taskConfig.Dir, env)
-			if err != nil {
-				fmt.Println(err.Error())
-				// if the cmd exited with an error, bail immediately
-				os.Exit(1)
-			}
+	// add any task-specific env bits
+	env, err := taskConfig.compileEnv(task, topLevelEnv, params, exec.envOptions(file))
+	if err != nil {
+		return err
+	}
+
+	// mask secret values in the task's output
+	run := exec
+	if secrets := secretValues(env); len(secrets) > 0 {
+		stdout, stderr := newMaskWriter(exec.Stdout, secrets), newMaskWriter(exec.Stderr, secrets)
+		defer stdout.Flush()
+		defer stderr.Flush()
+
+		masked := *exec
+		masked.Stdout, masked.Stderr = stdout, stderr
+		run = &masked
+	}
+
+	// if there are no cmds then we intend to run a script with the same name as the task
+	if len(taskConfig.Cmds) == 0 {
+		taskConfig.Cmds = []string{config.script(task)}
+	}
+
+	return run.runTaskCmds(task, taskConfig, envVarsToStrings(resolveEnv(env)))
+}
+
+// runs a task's cmds and reports the result to OnResult
+func (exec *Executor) runTaskCmds(name string, t Task, env []string) error {
+	cmds := t.Cmds
+
+	start := time.Now()
+	var err error
+	for _, cmd := range cmds {
+		// if the cmd exited with an error, bail immediately
+		if err = exec.runCommand(cmd, t.Dir, env); err != nil {
+			err = &TaskError{Task: name, Err: err}
+			break
 		}
 	}
-	return nil
+
+	if exec.OnResult != nil {
+		exec.OnResult(Result{Task: name, Start: start, End: time.Now(), Err: err})
+	}
+	return err
 }
 
 func (exec *Executor) runCommand(cmd string, dir string, env []string) error {
+	return exec.runCommandTo(cmd, dir, env, exec.Stdout)
+}
+
+// runs cmd, writing its stdout to stdout rather than the executor's
+func (exec *Executor) runCommandTo(cmd string, dir string, env []string, stdout io.Writer) error {
 	f, err := syntax.NewParser().Parse(strings.NewReader(cmd), "")
 	if err != nil {
 		return err
 	}
 
 	r, err := interp.New(
-		interp.Params("-e"),
+		interp.Params(append([]string{"-e", "--"}, exec.Args...)...),
 		interp.Env(expand.ListEnviron(env...)),
 		interp.OpenHandler(interp.DefaultOpenHandler()),
-		interp.StdIO(exec.Stdin, exec.Stdout, exec.Stderr),
+		interp.StdIO(exec.Stdin, stdout, exec.Stderr),
 		interp.Dir(dir),
 	)
 	if err != nil {
 		return err
 	}
 
-	err = r.Run(context.TODO(), f)
+	err = r.Run(exec.context(), f)
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+func (exec *Executor) context() context.Context {
+	if exec.ctx == nil {
+		return context.Background()
+	}
+	return exec.ctx
+}
+
 func (exec *Executor) ListTasksFromTaskFile(regex *regexp.Regexp, format output.OutputFormat) {
 	tasks := filterTasks(&exec.Config.Tasks, regex)
 	indent := "  "
+	var prev string
 
 	switch format {
 	case output.JSON:
 		json.NewEncoder(os.Stdout).Encode(tasks)
 	case output.Markdown:
-		for name, t := range tasks {
+		for _, name := range namespaceOrder(tasks) {
+			t := tasks[name]
+			if ns := namespace(name); ns != namespace(prev) {
+				fmt.Printf("# %s\n", ns)
+			}
+			prev = name
 			fmt.Printf("## %s\n", name)
 			if len(t.Cmds) > 0 {
 				for _, cmd := range t.Cmds {
 					fmt.Printf("%s- %s\n", indent, cmd)
 				}
 			} else {
-				fmt.Printf("%s- %s/%s\n", indent, exec.Config.ScriptDir, name)
+				fmt.Printf("%s- %s\n", indent, exec.Config.script(name))
 			}
 		}
 	case output.TOML:
 		toml.NewEncoder(os.Stdout).Encode(tasks)
 	case output.Text:
-		for name, t := range tasks {
+		for _, name := range namespaceOrder(tasks) {
+			t := tasks[name]
+
+			// included tasks are grouped under their namespace
+			if ns := namespace(name); ns != namespace(prev) {
+				fmt.Printf("# %s\n\n", ns)
+			}
+			prev = name
+
 			// name
 			fmt.Printf("%s:\n", name)
 
@@ -239,7 +452,24 @@ func (exec *Executor) ListTasksFromTaskFile(regex *regexp.Regexp, format output.
 					fmt.Printf("%s\n", indent+indent+cmd)
 				}
 			} else {
-				fmt.Printf("%s%s/%s\n", indent+indent, exec.Config.ScriptDir, name)
+				fmt.Printf("%s%s\n", indent+indent, exec.Config.script(name))
+			}
+
+			// params
+			if len(t.Params) > 0 {
+				fmt.Printf("%sparams:\n", indent)
+				for _, name := range sortedParamNames(t.Params) {
+					fmt.Printf("%s%s\n", strings.Repeat(indent, 2), t.Params[name].describe(name))
+				}
+			}
+
+			// vars
+			if len(t.Vars) > 0 {
+				fmt.Printf("%svars:\n", indent)
+				for _, name := range slices.Sorted(maps.Keys(t.Vars)) {
+					value, _ := t.Vars[name].MarshalTOML()
+					fmt.Printf("%s%s = %s\n", strings.Repeat(indent, 2), name, value)
+				}
 			}
 
 			// dir
@@ -248,13 +478,43 @@ func (exec *Executor) ListTasksFromTaskFile(regex *regexp.Regexp, format output.
 			}
 
 			// dotenv
-			if t.DotEnv != "" {
+			if len(t.DotEnv) > 0 {
 				fmt.Printf("%sdotenv: %s\n", indent, t.DotEnv)
 			}
 
+			// extends
+			if len(t.Extends) > 0 {
+				fmt.Printf("%sextends: %v\n", indent, []string(t.Extends))
+			}
+
+			// abstract
+			if t.Abstract {
+				fmt.Printf("%sabstract: %t\n", indent, t.Abstract)
+			}
+
 			// pure
-			if t.Pure == true {
-				fmt.Printf("%spure: %t\n", indent, t.Pure)
+			if t.isPure() {
+				fmt.Printf("%spure: %t\n", indent, *t.Pure)
+			}
+
+			// secrets
+			if len(t.Secrets) > 0 {
+				fmt.Printf("%ssecrets: %v\n", indent, t.Secrets)
+			}
+
+			// pure passthrough
+			if len(t.PurePassthrough) > 0 {
+				fmt.Printf("%spure_passthrough: %v\n", indent, t.PurePassthrough)
+			}
+
+			// template
+			if t.Template != nil && !*t.Template {
+				fmt.Printf("%stemplate: %t\n", indent, *t.Template)
+			}
+
+			// watch
+			if len(t.Watch) > 0 {
+				fmt.Printf("%swatch: %v\n", indent, t.Watch)
 			}
 
 			fmt.Println("")
@@ -264,10 +524,26 @@ func (exec *Executor) ListTasksFromTaskFile(regex *regexp.Regexp, format output.
 
 // verifies the tasks provided at the command line exist
 func (exec *Executor) VerifyTasks(tasks []string) error {
+	for _, pattern := range tasks {
+		matches := exec.MatchTasks(pattern)
+		if len(matches) == 0 {
+			return fmt.Errorf("no tasks match '%s'", pattern)
+		}
+		if err := exec.verifyTasks(matches); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (exec *Executor) verifyTasks(tasks []string) error {
 	for _, task := range tasks {
 		if _, ok := exec.Config.Tasks[task]; !ok {
 			return fmt.Errorf("task '%s' not found in taskfile", task)
 		}
+		if exec.Config.Tasks[task].Abstract {
+			return fmt.Errorf("task '%s' is abstract and can't be run", task)
+		}
 
 		// if a task specifies deps, verify they exist
 		if len(exec.Config.Tasks[task].Deps) > 0 {
@@ -276,6 +552,9 @@ func (exec *Executor) VerifyTasks(tasks []string) error {
 					if _, ok := exec.Config.Tasks[dep]; !ok {
 						return fmt.Errorf("task '%s' not found in taskfile", dep)
 					}
+					if exec.Config.Tasks[dep].Abstract {
+						return fmt.Errorf("task '%s' is abstract and can't be a dep of '%s'", dep, task)
+					}
 				}
 			}
 		}
@@ -286,6 +565,10 @@ func (exec *Executor) VerifyTasks(tasks []string) error {
 func filterTasks(tasks *map[string]Task, regex *regexp.Regexp) map[string]Task {
 	filtered := make(map[string]Task)
 	for k, v := range *tasks {
+		// global tasks are listed once, in the global namespace
+		if v.globalAlias {
+			continue
+		}
 		if regex.MatchString(k) {
 			filtered[k] = v
 		}
@@ -293,38 +576,28 @@ func filterTasks(tasks *map[string]Task, regex *regexp.Regexp) map[string]Task {
 	return filtered
 }
 
-func NewTaskConfig(taskFile, cliArgs string, listTasks bool) (*Config, error) {
-	var err error
-	if taskFile == "" {
+// loads taskFiles merged in order, or when there are none (or just "") the
+// tasks.toml found in the current dir or its parents, along with the user's
+// global taskfile
+func NewTaskConfig(taskFiles ...string) (*Config, error) {
+	if len(taskFiles) == 0 || len(taskFiles) == 1 && taskFiles[0] == "" {
 		dir, _ := os.Getwd()
-		taskFile, err = findTaskFile(dir, "tasks.toml")
+		taskFile, err := findTaskFile(dir, "tasks.toml")
 		if err != nil {
-			return nil, err
+			// outside of a project, fall back to the global taskfile
+			if _, statErr := os.Stat(globalTaskFile()); statErr != nil {
+				return nil, err
+			}
+			return globalConfig()
 		}
+		taskFiles = []string{taskFile}
 	}
 
-	// render the task file as a template
-	rendered, err := render(taskFile, cliArgs, listTasks)
+	config, err := loadTaskFiles(taskFiles, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	// parse the task file
-	var config Config
-	if _, err := toml.Decode(rendered.String(), &config); err != nil {
-		return nil, err
-	}
-
-	// set the task file dir, used as the base for a task's working directory
-	config.TaskFileDir = filepath.Dir(taskFile)
-	config.TaskFilePath = taskFile
-
-	// set the script dir
-	if len(config.ScriptDir) == 0 {
-		config.ScriptDir = "tsk"
-	}
-
-	return &config, nil
+	return config, config.includeGlobal()
 }
 
 func findTaskFile(dir, taskFile string) (string, error) {
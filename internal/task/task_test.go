@@ -2,9 +2,11 @@ package task
 
 import (
 	"bytes"
+	"errors"
 	"os"
 	"path/filepath"
 	"regexp"
+	"strings"
 	"testing"
 )
 
@@ -19,11 +21,10 @@ func TestMain(m *testing.M) {
 func TestConfig_CompileEnv(t *testing.T) {
 	t.Run("without dotenv", func(t *testing.T) {
 		config := Config{
-			Env: map[string]string{
-				"FOO": "bar",
-				"BAZ": "qux",
+			Env: map[string]EnvValue{
+				"FOO": {Value: "bar"},
+				"BAZ": {Value: "qux"},
 			},
-			DotEnv:      "",
 			TaskFileDir: "/some/path",
 		}
 
@@ -61,10 +62,10 @@ func TestConfig_CompileEnv(t *testing.T) {
 		defer removeFile(t, dotEnvPath)
 
 		config := Config{
-			Env: map[string]string{
-				"FOO": "bar",
+			Env: map[string]EnvValue{
+				"FOO": {Value: "bar"},
 			},
-			DotEnv:      filepath.Base(dotEnvPath),
+			DotEnv:      DotEnvFiles{{Path: filepath.Base(dotEnvPath)}},
 			TaskFileDir: filepath.Dir(dotEnvPath),
 		}
 
@@ -74,10 +75,14 @@ func TestConfig_CompileEnv(t *testing.T) {
 		}
 
 		expectedEnv := []string{
-			"FOO=bar_from_dotenv", // overwritten by dotenv
+			"FOO=bar", // the top-level env overrides the top-level dotenv
 			"BAZ=qux_from_dotenv",
 		}
 
+		if len(env) != len(expectedEnv) {
+			t.Fatalf("expected %d env vars, got %d", len(expectedEnv), len(env))
+		}
+
 		for _, e := range expectedEnv {
 			found := false
 			for _, actual := range env {
@@ -94,7 +99,7 @@ func TestConfig_CompileEnv(t *testing.T) {
 
 	t.Run("error loading dotenv", func(t *testing.T) {
 		config := Config{
-			DotEnv:      "nonexistent.env",
+			DotEnv:      DotEnvFiles{{Path: "nonexistent.env"}},
 			TaskFileDir: "/some/nonexistent/path",
 		}
 
@@ -109,11 +114,12 @@ func TestConfig_CompileEnv(t *testing.T) {
 func TestTask_CompileEnv(t *testing.T) {
 	t.Run("with task-specific env and inherited environment", func(t *testing.T) {
 		baseEnv := []string{"GLOBAL=global_value"}
+		pure := false
 		task := Task{
-			Env: map[string]string{
-				"TASK_KEY": "task_value",
+			Env: map[string]EnvValue{
+				"TASK_KEY": {Value: "task_value"},
 			},
-			Pure: false,
+			Pure: &pure,
 		}
 
 		compiledEnv, err := task.CompileEnv(baseEnv)
@@ -141,11 +147,12 @@ func TestTask_CompileEnv(t *testing.T) {
 	})
 
 	t.Run("pure environment", func(t *testing.T) {
+		pure := true
 		task := Task{
-			Env: map[string]string{
-				"TASK_KEY": "task_value",
+			Env: map[string]EnvValue{
+				"TASK_KEY": {Value: "task_value"},
 			},
-			Pure: true,
+			Pure: &pure,
 		}
 
 		compiledEnv, err := task.CompileEnv([]string{})
@@ -179,7 +186,7 @@ func TestTask_CompileEnv(t *testing.T) {
 		defer removeFile(t, dotEnvPath)
 
 		task := Task{
-			DotEnv: filepath.Base(dotEnvPath),
+			DotEnv: DotEnvFiles{{Path: filepath.Base(dotEnvPath)}},
 			Dir:    filepath.Dir(dotEnvPath),
 		}
 
@@ -362,9 +369,9 @@ func TestFindTaskFile(t *testing.T) {
 
 // test .env file is loaded
 func TestDotEnv(t *testing.T) {
-	var taskFile, cliArgs string
+	var taskFile string
 
-	config, err := NewTaskConfig(taskFile, cliArgs, false)
+	config, err := NewTaskConfig(taskFile)
 	if err != nil {
 		panic(err)
 	}
@@ -386,9 +393,9 @@ func TestDotEnv(t *testing.T) {
 	}
 }
 
-// `task_name.DotEnv` overrides `task_name.Env`
+// `task_name.Env` overrides `task_name.DotEnv`
 func TestEnvInheritance(t *testing.T) {
-	expected := "baz"
+	expected := "baz2"
 	out := new(bytes.Buffer)
 	exec := Executor{
 		Stdout: out,
@@ -396,8 +403,8 @@ func TestEnvInheritance(t *testing.T) {
 			Tasks: map[string]Task{
 				"default": {
 					// examples/.env sets BAR=baz
-					DotEnv: ".env",
-					Env:    map[string]string{"BAR": "baz2"},
+					DotEnv: DotEnvFiles{{Path: ".env"}},
+					Env:    map[string]EnvValue{"BAR": {Value: "baz2"}},
 					Cmds:   []string{"echo $BAR"},
 				},
 			},
@@ -409,19 +416,64 @@ func TestEnvInheritance(t *testing.T) {
 		t.Errorf("Expected no error, got %s", err)
 	}
 
-	re := regexp.MustCompile(expected)
-	if !re.Match(out.Bytes()) {
+	if out.String() != expected+"\n" {
 		t.Errorf("Expected '%s', got %s", expected, out.String())
 	}
 }
 
+// the task's env overrides the parent env
+func TestParentEnvInheritance(t *testing.T) {
+	t.Setenv("BAR", "from_parent")
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: &Config{
+			Tasks: map[string]Task{
+				"default": {
+					Env:  map[string]EnvValue{"BAR": {Value: "from_task"}},
+					Cmds: []string{"echo $BAR"},
+				},
+			},
+		},
+	}
+
+	exec.RunTasks(exec.Config, &[]string{"default"})
+	if out.String() != "from_task\n" {
+		t.Errorf("Expected 'from_task', got %s", out.String())
+	}
+}
+
+// a task's env doesn't leak into the tasks that run after it
+func TestEnvIsFreshForEachTask(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: &Config{
+			Tasks: map[string]Task{
+				"one": {
+					Env:  map[string]EnvValue{"LEAKED": {Value: "one"}},
+					Cmds: []string{"echo one"},
+				},
+				"two": {
+					Cmds: []string{"echo two${LEAKED:-}"},
+				},
+			},
+		},
+	}
+
+	exec.RunTasks(exec.Config, &[]string{"one", "two"})
+	if out.String() != "one\ntwo\n" {
+		t.Errorf("Expected 'one\\ntwo\\n', got %q", out.String())
+	}
+}
+
 func TestGlobalEnv(t *testing.T) {
 	expected := "baz2"
 	out := new(bytes.Buffer)
 	exec := Executor{
 		Stdout: out,
 		Config: &Config{
-			Env: map[string]string{"BAR": expected},
+			Env: map[string]EnvValue{"BAR": {Value: expected}},
 			Tasks: map[string]Task{
 				"default": {
 					Cmds: []string{"echo $BAR"},
@@ -444,10 +496,10 @@ func TestGlobalEnvInheritance(t *testing.T) {
 	exec := Executor{
 		Stdout: out,
 		Config: &Config{
-			Env: map[string]string{"BAR": "baz"},
+			Env: map[string]EnvValue{"BAR": {Value: "baz"}},
 			Tasks: map[string]Task{
 				"default": {
-					Env:  map[string]string{"BAR": expected},
+					Env:  map[string]EnvValue{"BAR": {Value: expected}},
 					Cmds: []string{"echo $BAR"},
 				},
 			},
@@ -483,15 +535,16 @@ func TestFilterTasks(t *testing.T) {
 
 // CLI_ARGS template
 func TestTemplates(t *testing.T) {
-	cliArgs := "foobar"
-	expected := regexp.MustCompile(cliArgs)
+	cliArgs := []string{"foobar"}
+	expected := regexp.MustCompile(cliArgs[0])
 	wd, _ := os.Getwd()
 	path, _ := findTaskFile(wd, "tasks.toml")
-	config, _ := NewTaskConfig(path, cliArgs, false)
+	config, _ := NewTaskConfig(path)
 	out := new(bytes.Buffer)
 	exec := Executor{
 		Stdout: out,
 		Config: config,
+		Args:   cliArgs,
 	}
 
 	exec.RunTasks(exec.Config, &[]string{"template"})
@@ -519,23 +572,169 @@ func TestRunTasksWithInvalidDependency(t *testing.T) {
 	}
 }
 
-// when building --list output for tasks that use CLI_ARGS test that placeholder
-// text is inserted when CLI_ARGS arent provided
-func TestTemplatesWithPlaceholders(t *testing.T) {
-	placeholder := "{{.CLI_ARGS}}"
-	expected := regexp.MustCompile(placeholder)
+func TestOnResult(t *testing.T) {
+	var results []Result
+	exec := Executor{
+		Stdout: new(bytes.Buffer),
+		Config: &Config{
+			Tasks: map[string]Task{
+				"ok": {
+					Cmds: []string{"true"},
+				},
+				"fail": {
+					Cmds: []string{"exit 3"},
+					Deps: [][]string{{"ok"}},
+				},
+			},
+		},
+		OnResult: func(r Result) {
+			results = append(results, r)
+		},
+	}
+
+	err := exec.RunTasks(exec.Config, &[]string{"fail"})
+
+	var taskErr *TaskError
+	if !errors.As(err, &taskErr) || taskErr.Task != "fail" {
+		t.Fatalf("Expected a TaskError for 'fail', got %v", err)
+	}
+	if ExitCode(err) != 3 {
+		t.Errorf("Expected exit code 3, got %d", ExitCode(err))
+	}
+
+	if len(results) != 2 {
+		t.Fatalf("Expected 2 results, got %d", len(results))
+	}
+	if results[0].Task != "ok" || results[0].Err != nil {
+		t.Errorf("Expected 'ok' to succeed, got %+v", results[0])
+	}
+	if results[1].Task != "fail" || results[1].Err == nil {
+		t.Errorf("Expected 'fail' to fail, got %+v", results[1])
+	}
+}
+
+// skipped tasks and their deps don't run
+func TestSkip(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: &Config{
+			Tasks: map[string]Task{
+				"one":   {Cmds: []string{"echo one"}},
+				"two":   {Cmds: []string{"echo two"}, Deps: [][]string{{"one"}}},
+				"three": {Cmds: []string{"echo three"}},
+			},
+		},
+		Skip: map[string]bool{"two": true},
+	}
+
+	err := exec.RunTasks(exec.Config, &[]string{"two", "three"})
+	if err != nil {
+		t.Errorf("Expected no error, got %s", err)
+	}
+
+	if out.String() != "three\n" {
+		t.Errorf("Expected only 'three' to run, got %s", out.String())
+	}
+}
+
+func TestKeepGoing(t *testing.T) {
+	out := new(bytes.Buffer)
+	exec := Executor{
+		Stdout: out,
+		Config: &Config{
+			Tasks: map[string]Task{
+				"lint":      {Cmds: []string{"exit 2"}},
+				"test":      {Cmds: []string{"echo test"}},
+				"typecheck": {Cmds: []string{"exit 1"}},
+				"ci": {
+					Deps: [][]string{{"lint"}},
+					Cmds: []string{"echo ci"},
+				},
+			},
+		},
+		KeepGoing: true,
+	}
+
+	err := exec.RunTasks(exec.Config, &[]string{"lint", "ci", "test", "typecheck"})
+
+	var failed *FailedTasksError
+	if !errors.As(err, &failed) {
+		t.Fatalf("Expected a FailedTasksError, got %v", err)
+	}
+
+	// lint is reported once even though it failed twice, and ci never ran
+	expected := "failed tasks:\n  lint: exit status 2\n  typecheck: exit status 1"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+	if out.String() != "test\n" {
+		t.Errorf("Expected only 'test' to succeed, got %s", out.String())
+	}
+}
+
+// args keep their boundaries and aren't expanded by the shell
+func TestCliArgsAreQuoted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.toml")
+	os.WriteFile(path, []byte(`
+[tasks.quoted]
+cmds = [
+  "printf '[%s]' {{.CLI_ARGS}}",
+  "printf '[%s]' \"$@\"",
+  "printf '[%s]' {{.CLI_ARGS_RAW}}",
+  "printf '[%s]\n' '{{index .Args 1}}'",
+]
+`), 0644)
+
+	cliArgs := []string{"hello world", "$HOME"}
+	config, err := NewTaskConfig(path)
+	if err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	out := new(bytes.Buffer)
+	exec := Executor{Stdout: out, Config: config, Args: cliArgs}
+	if err := exec.RunTasks(config, &[]string{"quoted"}); err != nil {
+		t.Fatalf("Expected no error, got: %v", err)
+	}
+
+	expected := "[hello world][$HOME]" + "[hello world][$HOME]" + "[hello][world][" + os.Getenv("HOME") + "]" + "[$HOME]\n"
+	if out.String() != expected {
+		t.Errorf("Expected %q, got %q", expected, out.String())
+	}
+}
+
+// templates are rendered when a task runs, so --list shows them as written
+func TestTemplatesAreNotRenderedOnLoad(t *testing.T) {
 	wd, _ := os.Getwd()
 	path, _ := findTaskFile(wd, "tasks.toml")
-	config, _ := NewTaskConfig(path, "", true)
+	config, _ := NewTaskConfig(path)
+
+	if !strings.Contains(config.Tasks["template"].Cmds[0], "{{.CLI_ARGS}}") {
+		t.Errorf("Expected '{{.CLI_ARGS}}' in %v", config.Tasks["template"].Cmds)
+	}
+}
+
+// a broken template only breaks the task it's in, and the error says where it is
+func TestTemplateErrorsArePerTask(t *testing.T) {
 	out := new(bytes.Buffer)
 	exec := Executor{
 		Stdout: out,
-		Config: config,
+		Config: &Config{
+			Tasks: map[string]Task{
+				"ok":     {Cmds: []string{"echo ok"}},
+				"broken": {Cmds: []string{"echo ok", "echo {{.Nope}}"}},
+			},
+		},
 	}
 
-	exec.RunTasks(exec.Config, &[]string{"template"})
-	if !expected.Match(out.Bytes()) {
-		t.Errorf("Expected '%s' to match '%s'", placeholder, out.String())
+	if err := exec.RunTasks(exec.Config, &[]string{"ok"}); err != nil {
+		t.Errorf("Expected no error, got: %v", err)
+	}
+
+	err := exec.RunTasks(exec.Config, &[]string{"broken"})
+	if err == nil || !strings.Contains(err.Error(), "tasks.broken.cmds[1]") {
+		t.Errorf("Expected an error naming tasks.broken.cmds[1], got: %v", err)
 	}
 }
 
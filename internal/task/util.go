@@ -3,16 +3,17 @@ package task
 import (
 	"bytes"
 	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
-	"text/template"
+	"strings"
 
+	"github.com/BurntSushi/toml"
 	"github.com/joho/godotenv"
+	"mvdan.cc/sh/v3/syntax"
 )
 
-type Vals struct {
-	CLI_ARGS string
-}
-
 func alphabetizeTaskList(t *map[string]Task) *[]string {
 	var taskNames []string
 	for taskName := range *t {
@@ -22,16 +23,19 @@ func alphabetizeTaskList(t *map[string]Task) *[]string {
 	return &taskNames
 }
 
+// converts env to KEY=value pairs, sorted by key
 func ConvertEnvToStringSlice(env map[string]string) []string {
-	var envs []string
-	for k, v := range env {
-		envs = append(envs, fmt.Sprintf("%s=%s", k, v))
-	}
-	return envs
+	return envVarsToStrings(envVarsFromMap(env, ""))
 }
 
-func readDotEnv(filename string) (map[string]string, error) {
-	dotEnv, err := godotenv.Read(filename)
+// parses the contents of a dotenv file. values are left unexpanded so they can
+// be expanded against the env layers before the file, like any other env value
+func parseDotEnv(content []byte) (map[string]string, error) {
+	// godotenv expands variables against the file's own vars, escaping every $
+	// defers expansion to us. \$ in single-quoted values, which godotenv leaves
+	// alone, is unescaped by the expansion itself
+	escaped := bytes.ReplaceAll(content, []byte("$"), []byte(`\$`))
+	dotEnv, err := godotenv.UnmarshalBytes(escaped)
 	if err != nil {
 		return nil, err
 	}
@@ -39,32 +43,84 @@ func readDotEnv(filename string) (map[string]string, error) {
 	return dotEnv, nil
 }
 
-func appendDotEnvToEnv(env []string, dotenv string) ([]string, error) {
-	additionalEnv, err := readDotEnv(dotenv)
-	if err != nil {
-		// the dotenv file missing is non-fatal. log a warning and continue
-		fmt.Printf("Warning: Could not load dotenv file %s: %v\n", dotenv, err)
-		return env, nil
+// converts a glob to an anchored regexp. "*" and "?" don't cross "/" while "**"
+// matches any number of path elements. unlike shell globs, wildcards match
+// leading dots so that patterns behave like they do in .gitignore.
+func globToRegexp(glob string) (*regexp.Regexp, error) {
+	var re strings.Builder
+	re.WriteString("^")
+	for i := 0; i < len(glob); i++ {
+		switch c := glob[i]; c {
+		case '*':
+			if strings.HasPrefix(glob[i:], "**/") {
+				re.WriteString("(.*/)?")
+				i += 2
+			} else if strings.HasPrefix(glob[i:], "**") {
+				re.WriteString(".*")
+				i++
+			} else {
+				re.WriteString("[^/]*")
+			}
+		case '?':
+			re.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated character class in glob %q", glob)
+			}
+			class := glob[i+1 : i+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			re.WriteString("[" + class + "]")
+			i += end
+		default:
+			re.WriteString(regexp.QuoteMeta(string(c)))
+		}
 	}
-	env = append(env, ConvertEnvToStringSlice(additionalEnv)...)
-	return env, nil
+	re.WriteString("$")
+	return regexp.Compile(re.String())
 }
 
-func render(file, cliArgs string, cliArgsPlaceholder bool) (*bytes.Buffer, error) {
-	tmpl, err := template.ParseFiles(file)
-	if err != nil {
-		return nil, err
+// reports whether s contains any glob metacharacters
+func isGlob(s string) bool {
+	return strings.ContainsAny(s, "*?[")
+}
+
+// the user's config dir, $XDG_CONFIG_HOME or ~/.config
+func configDir() string {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return dir
 	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".config")
+}
 
-	// insert a placeholder value for cliArgs for display purposes
-	if cliArgsPlaceholder && cliArgs == "" {
-		cliArgs = "{{.CLI_ARGS}}"
+// replaces a leading ~ in path with the user's home dir
+func expandHome(path string) string {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
 	}
+	return filepath.Join(home, path[1:])
+}
 
-	var renderedBuffer bytes.Buffer
-	if err := tmpl.Execute(&renderedBuffer, &Vals{CLI_ARGS: cliArgs}); err != nil {
-		return nil, err
+// s quoted so the shell reads it as a single word, without expanding it
+func shellQuote(s string) string {
+	quoted, err := syntax.Quote(s, syntax.LangBash)
+	if err != nil {
+		// only invalid UTF-8 can't be quoted
+		return s
 	}
+	return quoted
+}
 
-	return &renderedBuffer, nil
+// s as a quoted TOML string
+func tomlString(s string) string {
+	var buf bytes.Buffer
+	toml.NewEncoder(&buf).Encode(map[string]string{"s": s})
+	return strings.TrimSpace(strings.TrimPrefix(buf.String(), "s = "))
 }
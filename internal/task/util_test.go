@@ -40,3 +40,33 @@ func TestConvertEnvToStringSlice(t *testing.T) {
 		}
 	}
 }
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		path    string
+		matches bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "cmd/tsk/main.go", true},
+		{"**/*.go", "main.go.swp", false},
+		{"src/**", "src/a/b", true},
+		{"LANG*", "LANGUAGE", true},
+		{"file?.txt", "file1.txt", true},
+		{"[ab].txt", "b.txt", true},
+		{"[!ab].txt", "b.txt", false},
+		{"a.b", "axb", false},
+	}
+
+	for _, test := range tests {
+		re, err := globToRegexp(test.glob)
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if got := re.MatchString(test.path); got != test.matches {
+			t.Errorf("%q matching %q: expected %t, got %t", test.glob, test.path, test.matches, got)
+		}
+	}
+}
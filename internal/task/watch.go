@@ -0,0 +1,222 @@
+package task
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// how long changes must settle before tasks are re-run
+const watchDebounce = 200 * time.Millisecond
+
+// the files watched for a set of tasks
+type watchSet struct {
+	roots    []string
+	patterns []*regexp.Regexp
+	ignore   *gitignore
+	baseDir  string
+}
+
+// runs the tasks, then runs them again each time a watched file changes.
+// changes made while the tasks are running, and shortly after, are ignored, so
+// tasks that write into the files they watch don't re-run themselves. changes
+// in .git, .tsk and anything gitignored (generated files) are ignored too.
+func (exec *Executor) Watch(config *Config, tasks *[]string) error {
+	if err := exec.VerifyTasks(*tasks); err != nil {
+		return err
+	}
+
+	ws, err := exec.newWatchSet(config, *tasks)
+	if err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	defer watcher.Close()
+
+	for _, root := range ws.roots {
+		if err := ws.addDirs(watcher, root); err != nil {
+			return err
+		}
+	}
+
+	var (
+		// closed when the in-flight run finishes, nil between runs
+		done     chan struct{}
+		settled  time.Time
+		debounce = time.NewTimer(0) // fires immediately for the first run
+	)
+
+	for {
+		select {
+		case <-exec.context().Done():
+			if done != nil {
+				<-done
+			}
+			return nil
+		case <-done:
+			// changes from the run's last writes can arrive after it finishes
+			done, settled = nil, time.Now().Add(watchDebounce)
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+
+			// watch directories created after startup too
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					ws.addDirs(watcher, event.Name)
+				}
+			}
+
+			if done == nil && time.Now().After(settled) && ws.matches(event.Name) {
+				debounce.Reset(watchDebounce)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			fmt.Fprintf(exec.Stderr, "watch error: %s\n", err)
+		case <-debounce.C:
+			done = make(chan struct{})
+			go func(done chan struct{}) {
+				defer close(done)
+				if err := exec.RunTasks(config, tasks); err != nil && exec.context().Err() == nil {
+					fmt.Fprintln(exec.Stderr, err)
+				}
+			}(done)
+		}
+	}
+}
+
+// collects the watch globs of tasks and their deps, with their watch and dir
+// rendered as they are when they run. when none of them declare any, everything
+// in the first task's dir is watched
+func (exec *Executor) newWatchSet(config *Config, tasks []string) (*watchSet, error) {
+	baseDir, err := filepath.Abs(config.TaskFileDir)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := readGitignore(baseDir)
+	if err != nil {
+		return nil, err
+	}
+	ws := &watchSet{ignore: ignore, baseDir: baseDir}
+
+	var globs []string
+	for _, root := range tasks {
+		// deps are rendered with the params given to the task that runs them
+		for _, name := range exec.taskTree(root) {
+			t, _, err := exec.renderTask(config, name, exec.Params[root])
+			if err != nil {
+				return nil, err
+			}
+			for _, glob := range t.Watch {
+				globs = append(globs, filepath.Join(taskDir(config, name, t), glob))
+			}
+		}
+	}
+
+	if len(globs) == 0 && len(tasks) > 0 {
+		t, _, err := exec.renderTask(config, tasks[0], exec.Params[tasks[0]])
+		if err != nil {
+			return nil, err
+		}
+		globs = append(globs, filepath.Join(taskDir(config, tasks[0], t), "**"))
+	}
+
+	for _, glob := range globs {
+		glob, err := filepath.Abs(glob)
+		if err != nil {
+			return nil, err
+		}
+		re, err := globToRegexp(filepath.ToSlash(glob))
+		if err != nil {
+			return nil, err
+		}
+		ws.patterns = append(ws.patterns, re)
+		ws.roots = append(ws.roots, globRoot(glob))
+	}
+
+	return ws, nil
+}
+
+// adds dir and all of its subdirectories to the watcher, skipping ignored ones
+func (ws *watchSet) addDirs(watcher *fsnotify.Watcher, dir string) error {
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			// the root may not exist (yet), which isn't fatal
+			return fs.SkipDir
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if path != dir && ws.ignored(path, true) {
+			return fs.SkipDir
+		}
+		return watcher.Add(path)
+	})
+	return err
+}
+
+// reports whether a changed path should trigger a re-run
+func (ws *watchSet) matches(path string) bool {
+	if ws.ignored(path, false) {
+		return false
+	}
+	slashed := filepath.ToSlash(path)
+	for _, re := range ws.patterns {
+		if re.MatchString(slashed) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ws *watchSet) ignored(path string, isDir bool) bool {
+	for _, part := range strings.Split(filepath.ToSlash(path), "/") {
+		if alwaysIgnoredDirs[part] {
+			return true
+		}
+	}
+
+	rel, err := filepath.Rel(ws.baseDir, path)
+	if err != nil {
+		return false
+	}
+	return ws.ignore.ignored(rel, isDir)
+}
+
+// the longest leading directory of a glob that doesn't contain wildcards
+func globRoot(glob string) string {
+	if !isGlob(glob) {
+		return filepath.Dir(glob)
+	}
+
+	var root []string
+	for _, part := range strings.Split(glob, string(filepath.Separator)) {
+		if isGlob(part) {
+			break
+		}
+		root = append(root, part)
+	}
+	return strings.Join(root, string(filepath.Separator))
+}
+
+// a task's working directory, defaulting to the dir of the taskfile it was
+// defined in, as when it runs
+func taskDir(config *Config, name string, t Task) string {
+	if t.Dir != "" {
+		return t.Dir
+	}
+	return config.fileOf(name).TaskFileDir
+}
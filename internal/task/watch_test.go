@@ -0,0 +1,219 @@
+package task
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWatchSetIncludesDeps(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{
+		TaskFileDir: dir,
+		Tasks: map[string]Task{
+			"build": {Watch: []string{"**/*.go"}},
+			"test": {
+				Watch: []string{"testdata/*"},
+				Deps:  [][]string{{"build"}},
+			},
+		},
+	}
+
+	ws, err := (&Executor{Config: config}).newWatchSet(config, []string{"test"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		matches bool
+	}{
+		{filepath.Join(dir, "main.go"), true},
+		{filepath.Join(dir, "cmd", "main.go"), true},
+		{filepath.Join(dir, "testdata", "input"), true},
+		{filepath.Join(dir, "README.md"), false},
+		{filepath.Join(dir, ".git", "x.go"), false},
+	}
+	for _, test := range tests {
+		if got := ws.matches(test.path); got != test.matches {
+			t.Errorf("matches(%q): expected %t, got %t", test.path, test.matches, got)
+		}
+	}
+}
+
+func TestWatchSetDefaultsToTaskDir(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, ".gitignore"), []byte("bin/\n"), 0644)
+	config := &Config{
+		TaskFileDir: dir,
+		Tasks:       map[string]Task{"test": {}},
+	}
+
+	ws, err := (&Executor{Config: config}).newWatchSet(config, []string{"test"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	if !ws.matches(filepath.Join(dir, "any", "file")) {
+		t.Error("expected files in the task dir to be watched")
+	}
+	if ws.matches(filepath.Join(dir, "bin", "tsk")) {
+		t.Error("expected gitignored files to be ignored")
+	}
+}
+
+// watch and dir are rendered like the rest of the task before they're watched
+func TestWatchSetRendersTemplates(t *testing.T) {
+	dir := t.TempDir()
+	config := &Config{
+		TaskFileDir: dir,
+		Vars:        map[string]EnvValue{"EXT": {Value: "go"}},
+		Tasks: map[string]Task{
+			"test": {
+				Dir:    "{{.TaskFileDir}}/{{.Params.pkg}}",
+				Watch:  []string{"*.{{.Vars.EXT}}"},
+				Params: map[string]Param{"pkg": {Default: "api"}},
+			},
+		},
+	}
+
+	ws, err := (&Executor{Config: config}).newWatchSet(config, []string{"test"})
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+	if !ws.matches(filepath.Join(dir, "api", "main.go")) {
+		t.Errorf("expected the rendered glob to be watched, got %v", ws.patterns)
+	}
+}
+
+// an included task's globs are relative to its own taskfile's dir
+func TestWatchSetIncludedTask(t *testing.T) {
+	dir := t.TempDir()
+	writeFiles(t, dir, map[string]string{
+		"tasks.toml":        "includes = { docker = \"docker/tasks.toml\" }\n",
+		"docker/tasks.toml": "[tasks.build]\nwatch = [\"*.go\"]\n\n[tasks.test]\n",
+	})
+	config, err := loadTaskFile(filepath.Join(dir, "tasks.toml"), nil)
+	if err != nil {
+		t.Fatalf("expected no error, got: %v", err)
+	}
+
+	for task, path := range map[string]string{"docker:build": "main.go", "docker:test": "any/file"} {
+		ws, err := (&Executor{Config: config}).newWatchSet(config, []string{task})
+		if err != nil {
+			t.Fatalf("expected no error, got: %v", err)
+		}
+		if !ws.matches(filepath.Join(dir, "docker", path)) {
+			t.Errorf("expected %s to watch docker/%s", task, path)
+		}
+		if ws.matches(filepath.Join(dir, path)) {
+			t.Errorf("expected %s not to watch %s in the root dir", task, path)
+		}
+	}
+}
+
+func TestWatchReruns(t *testing.T) {
+	dir := t.TempDir()
+	out := &syncBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	exec := Executor{
+		Stdout: out,
+		Stderr: out,
+		Config: &Config{
+			TaskFileDir: dir,
+			Tasks: map[string]Task{
+				"default": {
+					Watch: []string{"*.txt"},
+					Cmds:  []string{"echo run"},
+				},
+			},
+		},
+		ctx: ctx,
+	}
+
+	errs := make(chan error)
+	go func() { errs <- exec.Watch(exec.Config, &[]string{"default"}) }()
+
+	waitForOutput(t, out, "run\n")
+	// changes during the run and while it settles are ignored
+	time.Sleep(3 * watchDebounce)
+	os.WriteFile(filepath.Join(dir, "ignored.md"), []byte("x"), 0644)
+	os.WriteFile(filepath.Join(dir, "changed.txt"), []byte("x"), 0644)
+	waitForOutput(t, out, "run\nrun\n")
+
+	cancel()
+	if err := <-errs; err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+}
+
+// a task writing into the dir it watches doesn't re-run itself
+func TestWatchIgnoresOwnWrites(t *testing.T) {
+	dir := t.TempDir()
+	out := &syncBuffer{}
+	ctx, cancel := context.WithCancel(context.Background())
+	exec := Executor{
+		Stdout: out,
+		Stderr: out,
+		Config: &Config{
+			TaskFileDir: dir,
+			Tasks: map[string]Task{
+				"default": {Cmds: []string{"echo run", "date > bin.out"}},
+			},
+		},
+		ctx: ctx,
+	}
+
+	errs := make(chan error)
+	go func() { errs <- exec.Watch(exec.Config, &[]string{"default"}) }()
+
+	waitForOutput(t, out, "run\n")
+	time.Sleep(5 * watchDebounce)
+	cancel()
+	if err := <-errs; err != nil {
+		t.Errorf("expected no error, got %s", err)
+	}
+
+	if runs := strings.Count(out.String(), "run\n"); runs != 1 {
+		t.Errorf("expected the task to run once, ran %d times", runs)
+	}
+}
+
+//
+// helpers
+//
+
+// a buffer that's safe to read while tasks write to it
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func waitForOutput(t *testing.T, out *syncBuffer, expected string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if strings.Contains(out.String(), expected) {
+			return
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("expected output to contain %q, got %q", expected, out.String())
+}